@@ -0,0 +1,282 @@
+// Package assembler translates assembly (ASM) to machine code (HACK), double pass
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// first RAM address given to variables
+const varBase = 16
+
+// largest value of A instruction
+const maxConst = 1<<15 - 1
+
+// predefined symbols
+var symbols = map[string]int{
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+// comp field 'a cccccc', operands of binary operations in both orders
+var comp = map[string]uint16{
+	"0":   0x2a,
+	"1":   0x3f,
+	"-1":  0x3a,
+	"D":   0x0c,
+	"A":   0x30,
+	"M":   0x70,
+	"!D":  0x0d,
+	"!A":  0x31,
+	"!M":  0x71,
+	"-D":  0x0f,
+	"-A":  0x33,
+	"-M":  0x73,
+	"D+1": 0x1f,
+	"A+1": 0x37,
+	"M+1": 0x77,
+	"D-1": 0x0e,
+	"A-1": 0x32,
+	"M-1": 0x72,
+	"D+A": 0x02,
+	"A+D": 0x02,
+	"D+M": 0x42,
+	"M+D": 0x42,
+	"D-A": 0x13,
+	"D-M": 0x53,
+	"A-D": 0x07,
+	"M-D": 0x47,
+	"D&A": 0x00,
+	"A&D": 0x00,
+	"D&M": 0x40,
+	"M&D": 0x40,
+	"D|A": 0x15,
+	"A|D": 0x15,
+	"D|M": 0x55,
+	"M|D": 0x55,
+}
+
+// dest bits by register
+var dest = map[rune]uint16{
+	'A': 4,
+	'D': 2,
+	'M': 1,
+}
+
+var jump = map[string]uint16{
+	"":    0,
+	"JGT": 1,
+	"JEQ": 2,
+	"JGE": 3,
+	"JLT": 4,
+	"JNE": 5,
+	"JLE": 6,
+	"JMP": 7,
+}
+
+// Error is assembly error at source line
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Assembler translates ASM to HACK
+type Assembler struct {
+	Labels map[string]int // label -> index in ROM (code)
+	Vars   map[string]int // var -> index in RAM (data)
+	Code   []uint16       // machine code
+	Lines  []int          // source line of each instruction
+	source []string
+}
+
+// Assemble translates ASM from r to text HACK in w, one instruction per line
+func Assemble(r io.Reader, w io.Writer) error {
+	var a Assembler
+	if e := a.Parse(r); e != nil {
+		return e
+	}
+	return a.Write(w)
+}
+
+// Parse reads ASM and translates it, filling symbol tables and code
+func (a *Assembler) Parse(r io.Reader) error {
+	a.Labels = map[string]int{}
+	a.Vars = map[string]int{}
+	a.Code = nil
+	a.Lines = nil
+	a.source = nil
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		a.source = append(a.source, scanner.Text())
+	}
+	if e := scanner.Err(); e != nil {
+		return e
+	}
+
+	// first pass, fill in the labels
+	var rom int
+	for i, s := range a.source {
+		s = clean(s)
+		if s == "" {
+			continue
+		}
+		if !strings.HasPrefix(s, "(") {
+			rom++
+			continue
+		}
+		if !strings.HasSuffix(s, ")") {
+			return &Error{i + 1, "unterminated label"}
+		}
+		label := s[1 : len(s)-1]
+		if !isSymbol(label) {
+			return &Error{i + 1, fmt.Sprintf("bad label '%s'", label)}
+		}
+		if _, ok := a.Labels[label]; ok {
+			return &Error{i + 1, fmt.Sprintf("duplicate label '%s'", label)}
+		}
+		if _, ok := symbols[label]; ok {
+			return &Error{i + 1, fmt.Sprintf("label '%s' redefines predefined symbol", label)}
+		}
+		a.Labels[label] = rom
+	}
+
+	// second pass, translate
+	for i, s := range a.source {
+		s = clean(s)
+		if s == "" || strings.HasPrefix(s, "(") {
+			continue
+		}
+		var code uint16
+		var e error
+		if strings.HasPrefix(s, "@") {
+			code, e = a.instrA(s[1:])
+		} else {
+			code, e = instrC(s)
+		}
+		if e != nil {
+			return &Error{i + 1, e.Error()}
+		}
+		a.Code = append(a.Code, code)
+		a.Lines = append(a.Lines, i+1)
+	}
+	return nil
+}
+
+// Write outputs code in text HACK format
+func (a *Assembler) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, code := range a.Code {
+		fmt.Fprintf(bw, "%016b\n", code)
+	}
+	return bw.Flush()
+}
+
+// strip comments and all spaces
+func clean(s string) string {
+	if i := strings.Index(s, "//"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Join(strings.Fields(s), "")
+}
+
+func isSymbol(s string) bool {
+	if s == "" || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune("_.$:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Assembler) instrA(s string) (uint16, error) {
+	if s == "" {
+		return 0, fmt.Errorf("missing address")
+	}
+	if '0' <= s[0] && s[0] <= '9' {
+		i, e := strconv.Atoi(s)
+		if e != nil || i > maxConst {
+			return 0, fmt.Errorf("bad constant '%s'", s)
+		}
+		return uint16(i), nil
+	}
+	if !isSymbol(s) {
+		return 0, fmt.Errorf("bad symbol '%s'", s)
+	}
+	if i, ok := symbols[s]; ok {
+		return uint16(i), nil
+	}
+	if i, ok := a.Labels[s]; ok {
+		return uint16(i), nil
+	}
+	i, ok := a.Vars[s]
+	if !ok {
+		i = varBase + len(a.Vars)
+		a.Vars[s] = i
+	}
+	return uint16(i), nil
+}
+
+// dest=comp;jump, dest and jump are optional
+func instrC(s string) (uint16, error) {
+	var d, j uint16
+	if i := strings.Index(s, "="); i >= 0 {
+		for _, r := range s[:i] {
+			bit, ok := dest[r]
+			if !ok || d&bit != 0 {
+				return 0, fmt.Errorf("bad dest '%s'", s[:i])
+			}
+			d |= bit
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("empty dest")
+		}
+		s = s[i+1:]
+	}
+	if i := strings.Index(s, ";"); i >= 0 {
+		var ok bool
+		if j, ok = jump[s[i+1:]]; !ok || j == 0 {
+			return 0, fmt.Errorf("bad jump '%s'", s[i+1:])
+		}
+		s = s[:i]
+	}
+	c, ok := comp[s]
+	if !ok {
+		return 0, fmt.Errorf("bad comp '%s'", s)
+	}
+	return 0xe000 | c<<6 | d<<3 | j, nil
+}
@@ -0,0 +1,103 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	in := `// Computes R0 = 2 + 3
+@2
+D=A
+@3
+D=D+A   // inline comment
+@0
+M=D
+`
+	out := `0000000000000010
+1110110000010000
+0000000000000011
+1110000010010000
+0000000000000000
+1110001100001000
+`
+	buf := bytes.Buffer{}
+	if e := Assemble(strings.NewReader(in), &buf); e != nil {
+		t.Fatal(e)
+	}
+	if buf.String() != out {
+		t.Fatalf("want: %s, got: %s", out, buf.String())
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	in := `@i
+M=1
+(LOOP)
+  @i
+  D=M
+  @END
+  D;JGT
+  @sum
+  M = D + M
+  @LOOP
+  0;JMP
+(END)
+@END
+0;JMP
+@SCREEN
+`
+	var a Assembler
+	if e := a.Parse(strings.NewReader(in)); e != nil {
+		t.Fatal(e)
+	}
+	if a.Labels["LOOP"] != 2 || a.Labels["END"] != 10 {
+		t.Fatalf("labels %v", a.Labels)
+	}
+	if a.Vars["i"] != 16 || a.Vars["sum"] != 17 {
+		t.Fatalf("vars %v", a.Vars)
+	}
+	if a.Code[7] != 0xf088 || a.Code[12] != 16384 {
+		t.Fatalf("code %x %x", a.Code[7], a.Code[12])
+	}
+	if a.Lines[2] != 4 {
+		t.Fatalf("source line %d", a.Lines[2])
+	}
+}
+
+func TestComp(t *testing.T) {
+	for s, code := range map[string]uint16{
+		"D=-D":      0xe3d0,
+		"AM=M+D":    0xf0a8,
+		"MD=A+D":    0xe098,
+		"D;JGE":     0xe303,
+		"0;JMP":     0xea87,
+		"ADM=!M":    0xfc78,
+		"A=D&M":     0xf020,
+		"M=M-1;JLE": 0xfc8e,
+	} {
+		got, e := instrC(clean(s))
+		if e != nil || got != code {
+			t.Errorf("%s: %016b, want %016b (%v)", s, got, code, e)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for in, msg := range map[string]string{
+		"@1\nD=X+1":  "line 2: bad comp 'X+1'",
+		"(A)\n(A)":   "line 2: duplicate label 'A'",
+		"@40000":     "line 1: bad constant '40000'",
+		"\n\nD;JUMP": "line 3: bad jump 'JUMP'",
+		"DD=1":       "line 1: bad dest 'DD'",
+		"(LOOP":      "line 1: unterminated label",
+		"@1x":        "line 1: bad constant '1x'",
+		"(SP)":       "line 1: label 'SP' redefines predefined symbol",
+	} {
+		e := Assemble(strings.NewReader(in), &bytes.Buffer{})
+		if e == nil || e.Error() != msg {
+			t.Errorf("%q: got %v, want %s", in, e, msg)
+		}
+	}
+}
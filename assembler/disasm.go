@@ -0,0 +1,177 @@
+package assembler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// mnemonics by comp field, binary operations in the book order
+var mnemonic = map[uint16]string{}
+
+var jumpMnemonic = map[uint16]string{}
+
+func init() {
+	for s, c := range comp {
+		if old, ok := mnemonic[c]; ok && old[0] == 'D' {
+			continue
+		}
+		mnemonic[c] = s
+	}
+	for s, j := range jump {
+		jumpMnemonic[j] = s
+	}
+}
+
+// ReadHack reads machine code in text (lines of 16 '0' and '1') or raw (big endian words) format
+func ReadHack(r io.Reader) ([]uint16, error) {
+	data, e := ioutil.ReadAll(r)
+	if e != nil {
+		return nil, e
+	}
+	if isText(data) {
+		var code []uint16
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if len(line) != 16 {
+				return nil, &Error{i + 1, "expecting 16 bits"}
+			}
+			var word uint16
+			for _, c := range line {
+				word = word<<1 | uint16(c-'0')
+			}
+			code = append(code, word)
+		}
+		return code, nil
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("odd size of raw code")
+	}
+	code := make([]uint16, len(data)/2)
+	for i := range code {
+		code[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return code, nil
+}
+
+func isText(data []byte) bool {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return len(data) > 0
+	}
+	for _, c := range data {
+		switch c {
+		case '0', '1', '\n', '\r', ' ', '\t':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Disassemble translates HACK from r to ASM, names from syms are restored if given:
+// labels before their ROM address and in A instructions followed by a jump,
+// variables in A instructions followed by M access. Words with bit 15 set that are
+// no valid C instruction are written as Data comments, so they do not reassemble
+func Disassemble(r io.Reader, w io.Writer, syms *Symbols) error {
+	return disassemble(r, w, syms, false)
+}
+
+// DisassembleStrict is Disassemble that fails before writing anything if a word
+// is no instruction, so the output always reassembles to the same words
+func DisassembleStrict(r io.Reader, w io.Writer, syms *Symbols) error {
+	return disassemble(r, w, syms, true)
+}
+
+// Data marks word at ROM address that is no instruction
+func Data(word uint16, addr int) string {
+	return fmt.Sprintf("// DATA %016b (not an instruction at %d)", word, addr)
+}
+
+func disassemble(r io.Reader, w io.Writer, syms *Symbols, strict bool) error {
+	code, e := ReadHack(r)
+	if e != nil {
+		return e
+	}
+	for i, word := range code {
+		if _, ok := Decode(word); strict && word&0x8000 != 0 && !ok {
+			return fmt.Errorf("word %016b at %d is not an instruction", word, i)
+		}
+	}
+	labels := map[int][]string{}
+	romNames := map[int]string{}
+	ramNames := map[int]string{}
+	if syms != nil {
+		for name, addr := range syms.Labels {
+			labels[addr] = append(labels[addr], name)
+		}
+		for addr := range labels {
+			sort.Strings(labels[addr])
+			romNames[addr] = labels[addr][0]
+		}
+		for name, addr := range syms.Vars {
+			if old, ok := ramNames[addr]; !ok || name < old {
+				ramNames[addr] = name
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, word := range code {
+		for _, label := range labels[i] {
+			fmt.Fprintf(bw, "(%s)\n", label)
+		}
+		if word&0x8000 == 0 {
+			name := fmt.Sprint(word)
+			if i+1 < len(code) {
+				if next, ok := Decode(code[i+1]); ok {
+					switch {
+					case strings.Contains(next, ";") && romNames[int(word)] != "":
+						name = romNames[int(word)]
+					case strings.Contains(strings.Split(next, ";")[0], "M") && ramNames[int(word)] != "":
+						name = ramNames[int(word)]
+					}
+				}
+			}
+			fmt.Fprintf(bw, "@%s\n", name)
+			continue
+		}
+		s, ok := Decode(word)
+		if !ok {
+			s = Data(word, i)
+		}
+		fmt.Fprintln(bw, s)
+	}
+	return bw.Flush()
+}
+
+// Decode returns C instruction in dest=comp;jump form, false if word is no valid C instruction
+func Decode(word uint16) (string, bool) {
+	if word&0xe000 != 0xe000 {
+		return "", false
+	}
+	c, ok := mnemonic[word>>6&0x7f]
+	if !ok {
+		return "", false
+	}
+	var dst string
+	for _, r := range "AMD" {
+		if word>>3&dest[r] != 0 {
+			dst += string(r)
+		}
+	}
+	s := c
+	if dst != "" {
+		s = dst + "=" + s
+	}
+	if j := jumpMnemonic[word&7]; j != "" {
+		s += ";" + j
+	}
+	return s, true
+}
@@ -0,0 +1,134 @@
+package assembler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAll(t *testing.T) {
+	for s, c := range comp {
+		word := 0xe000 | c<<6
+		got, ok := Decode(word)
+		if !ok {
+			t.Fatalf("%s not decoded", s)
+		}
+		if back, _ := instrC(got); back != word {
+			t.Fatalf("%s decoded as %s", s, got)
+		}
+	}
+	if s, _ := Decode(0xfca8); s != "AM=M-1" {
+		t.Fatalf("got %s", s)
+	}
+	if _, ok := Decode(0xff80); ok {
+		t.Fatal("invalid comp decoded")
+	}
+	if _, ok := Decode(0x8000); ok {
+		t.Fatal("invalid prefix decoded")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var a Assembler
+	if e := a.Parse(strings.NewReader(program)); e != nil {
+		t.Fatal(e)
+	}
+	hack := bytes.Buffer{}
+	a.Write(&hack)
+	syms := a.Symbols()
+	for _, s := range []*Symbols{nil, &syms} {
+		asm := bytes.Buffer{}
+		if e := Disassemble(bytes.NewReader(hack.Bytes()), &asm, s); e != nil {
+			t.Fatal(e)
+		}
+		again := bytes.Buffer{}
+		if e := Assemble(&asm, &again); e != nil {
+			t.Fatal(e)
+		}
+		if again.String() != hack.String() {
+			t.Fatalf("round trip failed\n%s", asm.String())
+		}
+	}
+}
+
+func TestRoundTripData(t *testing.T) {
+	words := []uint16{0xec10, 0x7fff, 0xe308} // D=A, data, M=D
+	raw := []byte{}
+	for _, word := range words {
+		raw = append(raw, byte(word>>8), byte(word))
+	}
+	asm := bytes.Buffer{}
+	if e := Disassemble(bytes.NewReader(raw), &asm, nil); e != nil {
+		t.Fatal(e)
+	}
+	hack := bytes.Buffer{}
+	if e := Assemble(&asm, &hack); e != nil {
+		t.Fatal(e)
+	}
+	code, _ := ReadHack(&hack)
+	if len(code) != len(words) || code[1] != 0x7fff || code[2] != 0xe308 {
+		t.Fatalf("round trip %x of\n%s", code, asm.String())
+	}
+
+	raw[2], raw[3] = 0xff, 0xff
+	asm.Reset()
+	if e := Disassemble(bytes.NewReader(raw), &asm, nil); e != nil {
+		t.Fatal(e)
+	}
+	if asm.String() != "D=A\n// DATA 1111111111111111 (not an instruction at 1)\nM=D\n" {
+		t.Fatalf("data not marked\n%s", asm.String())
+	}
+	asm.Reset()
+	e := DisassembleStrict(bytes.NewReader(raw), &asm, nil)
+	if e == nil || e.Error() != "word 1111111111111111 at 1 is not an instruction" || asm.Len() != 0 {
+		t.Fatalf("strict got %v\n%s", e, asm.String())
+	}
+}
+
+func TestDisassembleSymbols(t *testing.T) {
+	var a Assembler
+	a.Parse(strings.NewReader(program))
+	raw := []byte{}
+	for _, word := range a.Code {
+		raw = append(raw, byte(word>>8), byte(word))
+	}
+	raw = append(raw, 0xff, 0xff)
+	syms := a.Symbols()
+	asm := bytes.Buffer{}
+	if e := Disassemble(bytes.NewReader(raw), &asm, &syms); e != nil {
+		t.Fatal(e)
+	}
+	expected := `@10
+D=A
+@n
+M=D
+(Main.main)
+@n
+MD=M-1
+@Main.main
+D;JGT
+@Main.0
+M=D
+// DATA 1111111111111111 (not an instruction at 10)
+`
+	if asm.String() != expected {
+		t.Fatalf("want:\n%s\ngot:\n%s", expected, asm.String())
+	}
+}
+
+func TestReadHack(t *testing.T) {
+	code, e := ReadHack(strings.NewReader("0000000000000001\r\n1110110000010000\n"))
+	if e != nil || len(code) != 2 || code[1] != 0xec10 {
+		t.Fatalf("got %v %v", code, e)
+	}
+	if _, e := ReadHack(strings.NewReader("0101\n")); e == nil {
+		t.Fatal("short line accepted")
+	}
+	if _, e := ReadHack(bytes.NewReader([]byte{1, 2, 3})); e == nil {
+		t.Fatal("odd raw size accepted")
+	}
+	if code, _ := ReadHack(ioutil.NopCloser(bytes.NewReader([]byte{0x12, 0x34}))); code[0] != 0x1234 {
+		t.Fatal("raw word")
+	}
+}
@@ -0,0 +1,135 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ROMSize is the number of words of HACK ROM
+const ROMSize = 1 << 15
+
+// Size is ROM words taken by a VM function or a file
+type Size struct {
+	Name  string
+	File  string // VM file, Class.vm of function Class.name
+	Words int
+}
+
+// name of code before the first function
+const bootstrap = "(bootstrap)"
+
+// Sizes returns ROM words of VM functions of translated code: code from a function label,
+// Class.name without '$', up to the next one; largest first
+func (a *Assembler) Sizes() []Size {
+	type start struct {
+		name string
+		addr int
+	}
+	var starts []start
+	for name, addr := range a.Labels {
+		if strings.Contains(name, ".") && !strings.Contains(name, "$") {
+			starts = append(starts, start{name, addr})
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].addr < starts[j].addr || starts[i].addr == starts[j].addr && starts[i].name < starts[j].name
+	})
+	starts = append([]start{{bootstrap, 0}}, starts...)
+	var sizes []Size
+	for i, s := range starts {
+		end := len(a.Code)
+		if i+1 < len(starts) {
+			end = starts[i+1].addr
+		}
+		if s.name == bootstrap && end == 0 {
+			continue
+		}
+		sizes = append(sizes, Size{Name: s.name, File: fileOf(s.name), Words: end - s.addr})
+	}
+	SortSizes(sizes)
+	return sizes
+}
+
+// fileOf returns VM file of function by the translator naming, Class.vm of Class.name
+func fileOf(fn string) string {
+	if i := strings.Index(fn, "."); i >= 0 {
+		return fn[:i] + ".vm"
+	}
+	return ""
+}
+
+// SortSizes sorts largest first, then by name
+func SortSizes(sizes []Size) {
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Words != sizes[j].Words {
+			return sizes[i].Words > sizes[j].Words
+		}
+		return sizes[i].Name < sizes[j].Name
+	})
+}
+
+// ByFile sums sizes of functions by file, largest first
+func ByFile(sizes []Size) []Size {
+	words := map[string]int{}
+	for _, s := range sizes {
+		words[s.File] += s.Words
+	}
+	var files []Size
+	for file, n := range words {
+		name := file
+		if name == "" {
+			name = bootstrap
+		}
+		files = append(files, Size{Name: name, File: file, Words: n})
+	}
+	SortSizes(files)
+	return files
+}
+
+// Total sums words
+func Total(sizes []Size) int {
+	var n int
+	for _, s := range sizes {
+		n += s.Words
+	}
+	return n
+}
+
+// CheckSize fails when words exceed budget, ROMSize if budget is 0
+func CheckSize(words, budget int) error {
+	if budget <= 0 || budget > ROMSize {
+		budget = ROMSize
+	}
+	if words > budget {
+		return fmt.Errorf("program takes %d ROM words, %d over the budget of %d", words, words-budget, budget)
+	}
+	return nil
+}
+
+// WriteSizes writes report of sizes by function and by file with share of the budget,
+// ROMSize if budget is 0
+func WriteSizes(w io.Writer, sizes []Size, budget int) error {
+	if budget <= 0 || budget > ROMSize {
+		budget = ROMSize
+	}
+	bw := bufio.NewWriter(w)
+	for _, table := range []struct {
+		title string
+		sizes []Size
+	}{{"function", sizes}, {"file", ByFile(sizes)}} {
+		fmt.Fprintf(bw, "%6s %6s  %s\n", "words", "budget", table.title)
+		for _, s := range table.sizes {
+			fmt.Fprintf(bw, "%6d %5.1f%%  %s\n", s.Words, percent(s.Words, budget), s.Name)
+		}
+	}
+	total := Total(sizes)
+	fmt.Fprintf(bw, "%6d %5.1f%%  total of %d\n", total, percent(total, budget), budget)
+	return bw.Flush()
+}
+
+func percent(n, of int) float64 {
+	return 100 * float64(n) / float64(of)
+}
@@ -0,0 +1,74 @@
+package assembler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSizes(t *testing.T) {
+	in := `@256
+D=A
+@Sys.init
+0;JMP
+(Main.f)
+@0
+D=A
+(Main.f$LOOP)
+@Main.f$LOOP
+0;JMP
+(Sys.init)
+@Main.f
+0;JMP
+(Main.g)
+0;JMP
+`
+	var a Assembler
+	if e := a.Parse(strings.NewReader(in)); e != nil {
+		t.Fatal(e)
+	}
+	want := []Size{
+		{"(bootstrap)", "", 4},
+		{"Main.f", "Main.vm", 4},
+		{"Sys.init", "Sys.vm", 2},
+		{"Main.g", "Main.vm", 1},
+	}
+	if got := a.Sizes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v", got)
+	}
+	files := []Size{{"Main.vm", "Main.vm", 5}, {"(bootstrap)", "", 4}, {"Sys.vm", "Sys.vm", 2}}
+	if got := ByFile(want); !reflect.DeepEqual(got, files) {
+		t.Fatalf("by file %v", got)
+	}
+
+	out := bytes.Buffer{}
+	WriteSizes(&out, want, 100)
+	report := ` words budget  function
+     4   4.0%  (bootstrap)
+     4   4.0%  Main.f
+     2   2.0%  Sys.init
+     1   1.0%  Main.g
+ words budget  file
+     5   5.0%  Main.vm
+     4   4.0%  (bootstrap)
+     2   2.0%  Sys.vm
+    11  11.0%  total of 100
+`
+	if out.String() != report {
+		t.Fatalf("report\n%s", out.String())
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	if e := CheckSize(ROMSize, 0); e != nil {
+		t.Fatal(e)
+	}
+	e := CheckSize(ROMSize+2, 0)
+	if e == nil || e.Error() != "program takes 32770 ROM words, 2 over the budget of 32768" {
+		t.Fatalf("got %v", e)
+	}
+	if e := CheckSize(101, 100); e == nil || !strings.Contains(e.Error(), "1 over the budget of 100") {
+		t.Fatalf("got %v", e)
+	}
+}
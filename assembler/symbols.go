@@ -0,0 +1,91 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols maps labels to ROM and variables to RAM addresses
+type Symbols struct {
+	Labels map[string]int
+	Vars   map[string]int
+}
+
+// Symbols returns symbol table of parsed program
+func (a *Assembler) Symbols() Symbols {
+	return Symbols{Labels: a.Labels, Vars: a.Vars}
+}
+
+// WriteListing outputs every source line prefixed with ROM address and binary word of its instruction
+func (a *Assembler) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	next := 0 // next instruction
+	for i, s := range a.source {
+		switch {
+		case next < len(a.Lines) && a.Lines[next] == i+1:
+			fmt.Fprintf(bw, "%05d %016b  %s\n", next, a.Code[next], s)
+			next++
+		case strings.HasPrefix(clean(s), "("):
+			fmt.Fprintf(bw, "%05d %16s  %s\n", next, "", s)
+		default:
+			fmt.Fprintf(bw, "%5s %16s  %s\n", "", "", s)
+		}
+	}
+	return bw.Flush()
+}
+
+// Write outputs 'ROM address label' and 'RAM address variable' lines sorted by address
+func (s Symbols) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, table := range []struct {
+		mem  string
+		syms map[string]int
+	}{{"ROM", s.Labels}, {"RAM", s.Vars}} {
+		var names []string
+		for name := range table.syms {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := table.syms[names[i]], table.syms[names[j]]
+			return a < b || a == b && names[i] < names[j]
+		})
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s %d %s\n", table.mem, table.syms[name], name)
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadSymbols parses symbol file written by Symbols.Write
+func ReadSymbols(r io.Reader) (Symbols, error) {
+	s := Symbols{Labels: map[string]int{}, Vars: map[string]int{}}
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return s, &Error{line, "expecting 'ROM|RAM address name'"}
+		}
+		addr, e := strconv.Atoi(fields[1])
+		if e != nil {
+			return s, &Error{line, fmt.Sprintf("bad address '%s'", fields[1])}
+		}
+		switch fields[0] {
+		case "ROM":
+			s.Labels[fields[2]] = addr
+		case "RAM":
+			s.Vars[fields[2]] = addr
+		default:
+			return s, &Error{line, fmt.Sprintf("unknown memory '%s'", fields[0])}
+		}
+	}
+	return s, scanner.Err()
+}
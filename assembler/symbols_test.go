@@ -0,0 +1,70 @@
+package assembler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const program = `// count down
+@10
+D=A
+@n
+M=D
+(Main.main)
+@n
+MD=M-1 // decrement
+@Main.main
+D;JGT
+@Main.0
+M=D
+`
+
+func TestListing(t *testing.T) {
+	var a Assembler
+	if e := a.Parse(strings.NewReader(program)); e != nil {
+		t.Fatal(e)
+	}
+	buf := bytes.Buffer{}
+	a.WriteListing(&buf)
+	expected := `                        // count down
+00000 0000000000001010  @10
+00001 1110110000010000  D=A
+00002 0000000000010000  @n
+00003 1110001100001000  M=D
+00004                   (Main.main)
+00004 0000000000010000  @n
+00005 1111110010011000  MD=M-1 // decrement
+00006 0000000000000100  @Main.main
+00007 1110001100000001  D;JGT
+00008 0000000000010001  @Main.0
+00009 1110001100001000  M=D
+`
+	if buf.String() != expected {
+		t.Fatalf("want:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestSymbolFile(t *testing.T) {
+	var a Assembler
+	if e := a.Parse(strings.NewReader(program)); e != nil {
+		t.Fatal(e)
+	}
+	buf := bytes.Buffer{}
+	a.Symbols().Write(&buf)
+	expected := "ROM 4 Main.main\nRAM 16 n\nRAM 17 Main.0\n"
+	if buf.String() != expected {
+		t.Fatalf("want:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	syms, e := ReadSymbols(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(syms, a.Symbols()) {
+		t.Fatalf("read %v", syms)
+	}
+	if _, e := ReadSymbols(strings.NewReader("ROM x LOOP")); e == nil || e.Error() != "line 1: bad address 'x'" {
+		t.Fatalf("got %v", e)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"git.andmed.org/nand2tetris/assembler"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	listPath := flag.String("list", "", "write listing with ROM addresses to `file`")
+	symPath := flag.String("sym", "", "write label and variable addresses to `file`")
+	size := flag.Bool("size", false, "write ROM words by VM function and file to stderr")
+	budget := flag.Int("budget", assembler.ROMSize, "fail when ROM `words` exceed it")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: assembler [-list file.lst] [-sym file.sym] [-size] [-budget words] /path/to/file.asm")
+	}
+	path := flag.Arg(0)
+
+	file, e := os.Open(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer file.Close()
+
+	var a assembler.Assembler
+	if e := a.Parse(file); e != nil {
+		log.Fatalf("%s: %s", path, e)
+	}
+	if *size {
+		assembler.WriteSizes(os.Stderr, a.Sizes(), *budget)
+	}
+	if e := assembler.CheckSize(len(a.Code), *budget); e != nil {
+		log.Fatalf("%s: %s", path, e)
+	}
+	if e := a.Write(os.Stdout); e != nil {
+		log.Fatal(e)
+	}
+	if *listPath != "" {
+		writeFile(*listPath, a.WriteListing)
+	}
+	if *symPath != "" {
+		writeFile(*symPath, a.Symbols().Write)
+	}
+	log.Printf("%d instructions, %d labels, %d variables.\n", len(a.Code), len(a.Labels), len(a.Vars))
+}
+
+func writeFile(path string, write func(w io.Writer) error) {
+	f, e := os.Create(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	if e := write(f); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"flag"
 	"git.andmed.org/nand2tetris/compiler"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatal("Usage: compiler /path/to/fileORdir")
+	var opts compiler.Options
+	flag.BoolVar(&opts.Optimize, "O", false, "strength reduction of multiplication and division by constants")
+	flag.BoolVar(&opts.BoundsCheck, "bounds", false, "check array bounds at runtime")
+	flag.BoolVar(&opts.Debug, "debug", false, "check for null objects and division by zero at runtime")
+	checksPath := flag.String("checks", "", "runtime check table `file` (default checks.txt next to output)")
+	graphPath := flag.String("callgraph", "", "write call graph to `file`, .dot or .json")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: compiler [-O] [-bounds] [-debug] [-checks file] [-callgraph file.dot|file.json] /path/to/fileORdir")
+	}
+	path := flag.Arg(0)
+	opts.Checks = &compiler.Checks{}
+	if *graphPath != "" {
+		opts.Graph = compiler.NewCallGraph()
 	}
-	path := os.Args[1]
 
 	stat, e := os.Stat(path)
 	if e != nil {
@@ -19,17 +32,72 @@ func main() {
 	}
 
 	var files int
+	outDir := filepath.Dir(path)
 	if stat.IsDir() {
+		outDir = path
 		filenames, _ := filepath.Glob(path + "/*.jack")
 		for _, filename := range filenames {
-			compiler.CompilePath(filename)
+			if e := compiler.CompilePath(filename, opts); e != nil {
+				log.Fatal(e)
+			}
 			files++
 		}
 	} else {
 		files = 1
-		compiler.CompilePath(path)
+		if e := compiler.CompilePath(path, opts); e != nil {
+			log.Fatal(e)
+		}
+	}
+
+	if len(opts.Checks.Sites) > 0 {
+		if *checksPath == "" {
+			*checksPath = filepath.Join(outDir, "checks.txt")
+		}
+		writeChecks(*checksPath, opts.Checks)
+	}
+
+	if opts.Graph != nil {
+		writeGraph(*graphPath, opts.Graph)
 	}
 
 	log.Printf("Total %d files processed.\n", files)
 
 }
+
+func writeChecks(path string, checks *compiler.Checks) {
+	f, e := os.Create(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	if e := checks.Write(f); e != nil {
+		log.Fatal(e)
+	}
+	log.Printf("%d runtime checks listed in %s\n", len(checks.Sites), path)
+}
+
+// program entry points
+var roots = []string{"Main.main", "Sys.init"}
+
+func writeGraph(path string, graph *compiler.CallGraph) {
+	f, e := os.Create(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	switch filepath.Ext(path) {
+	case ".json":
+		e = graph.WriteJSON(f, roots...)
+	default:
+		e = graph.WriteDOT(f, roots...)
+	}
+	if e != nil {
+		log.Fatal(e)
+	}
+	for _, fn := range graph.Unreachable(roots...) {
+		log.Printf("unreachable: %s\n", fn)
+	}
+	for _, cycle := range graph.Cycles() {
+		log.Printf("recursive: %s\n", strings.Join(cycle, " -> "))
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"git.andmed.org/nand2tetris/assembler"
+	"log"
+	"os"
+)
+
+func main() {
+	symPath := flag.String("sym", "", "restore names from symbol `file` written by assembler -sym")
+	strict := flag.Bool("strict", false, "fail on words that are no instruction instead of marking them as data")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: disasm [-sym file.sym] [-strict] /path/to/file.hack")
+	}
+
+	var syms *assembler.Symbols
+	if *symPath != "" {
+		f, e := os.Open(*symPath)
+		if e != nil {
+			log.Fatal(e)
+		}
+		s, e := assembler.ReadSymbols(f)
+		f.Close()
+		if e != nil {
+			log.Fatalf("%s: %s", *symPath, e)
+		}
+		syms = &s
+	}
+
+	file, e := os.Open(flag.Arg(0))
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer file.Close()
+	disassemble := assembler.Disassemble
+	if *strict {
+		disassemble = assembler.DisassembleStrict
+	}
+	if e := disassemble(file, os.Stdout, syms); e != nil {
+		log.Fatalf("%s: %s", flag.Arg(0), e)
+	}
+}
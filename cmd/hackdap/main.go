@@ -0,0 +1,26 @@
+// Command hackdap is a Debug Adapter Protocol server on stdin and stdout: editors launch it
+// to debug a Jack or VM program directory, a .vm file or a .asm file, see package dap
+package main
+
+import (
+	"flag"
+	"git.andmed.org/nand2tetris/dap"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "log compiler and translator messages to stderr")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		log.Fatal("Usage: hackdap [-v]")
+	}
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	if e := dap.NewServer(os.Stdin, os.Stdout).Serve(); e != nil {
+		log.SetOutput(os.Stderr)
+		log.Fatal(e)
+	}
+}
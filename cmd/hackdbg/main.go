@@ -0,0 +1,97 @@
+// Command hackdbg debugs a program on the CPU emulator, reading commands from stdin;
+// a directory of Jack files is built with debug info for source level debugging
+package main
+
+import (
+	"flag"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/debugger"
+	"git.andmed.org/nand2tetris/debuginfo"
+	"git.andmed.org/nand2tetris/program"
+	"log"
+	"os"
+)
+
+func main() {
+	symPath := flag.String("sym", "", "symbol `file` of HACK code, as written by assembler -sym")
+	infoPath := flag.String("info", "", "debug info `file`, read for .asm and .hack, written when building a directory")
+	limit := flag.Uint64("limit", 100000000, "cycles per continue, 0 for no limit")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: hackdbg [-sym file.sym] [-info file.json] [-limit cycles] /path/to/jackDir|file.asm|file.hack")
+	}
+	path := flag.Arg(0)
+
+	var c *cpu.Computer
+	var syms assembler.Symbols
+	var info *debuginfo.Info
+	if stat, e := os.Stat(path); e == nil && stat.IsDir() {
+		a, built, e := debuginfo.Build(path, compiler.Options{Checks: &compiler.Checks{}})
+		if e != nil {
+			log.Fatal(e)
+		}
+		c = &cpu.Computer{}
+		c.Load(a.Code)
+		info, syms = built, built.Symbols()
+		if *infoPath != "" {
+			writeInfo(*infoPath, info)
+		}
+	} else {
+		var e error
+		if c, syms, e = program.LoadCPU(path); e != nil {
+			log.Fatal(e)
+		}
+		if *infoPath != "" {
+			info = readInfo(*infoPath)
+			syms = info.Symbols()
+		}
+	}
+	if *symPath != "" {
+		f, e := os.Open(*symPath)
+		if e != nil {
+			log.Fatal(e)
+		}
+		syms, e = assembler.ReadSymbols(f)
+		f.Close()
+		if e != nil {
+			log.Fatalf("%s: %s", *symPath, e)
+		}
+	}
+
+	d := debugger.New(c, syms)
+	d.Limit = *limit
+	if info != nil {
+		d.UseInfo(info)
+	}
+	if e := d.Run(os.Stdin, os.Stdout); e != nil {
+		log.Fatal(e)
+	}
+}
+
+func readInfo(path string) *debuginfo.Info {
+	f, e := os.Open(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	info, e := debuginfo.Read(f)
+	if e != nil {
+		log.Fatalf("%s: %s", path, e)
+	}
+	return info
+}
+
+func writeInfo(path string, info *debuginfo.Info) {
+	f, e := os.Create(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	if e := info.Write(f); e != nil {
+		log.Fatal(e)
+	}
+	if e := f.Close(); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,259 @@
+// Command hackrun runs a program headless until it halts, fails or runs out of cycles or time,
+// exit status tells which of them happened
+package main
+
+import (
+	"flag"
+	"fmt"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/program"
+	"git.andmed.org/nand2tetris/screen"
+	"git.andmed.org/nand2tetris/vm"
+	"git.andmed.org/nand2tetris/vmtranslator"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exit status
+const (
+	exitHalt   = 0 // Sys.halt, end of program or halt loop
+	exitBuild  = 1 // program can not be built or loaded
+	exitError  = 2 // Sys.error
+	exitCycles = 3 // cycle limit reached
+	exitTime   = 4 // time limit reached
+	exitFault  = 5 // emulator stopped on bad memory access or stack
+)
+
+// cycles run between time checks
+const chunk uint64 = 100000
+
+// machine is VM or CPU emulator
+type machine interface {
+	run(max uint64) (uint64, error)
+	stopped() bool
+	failed() (int16, bool) // Sys.error code
+	ram() []int16
+	text() string
+	screenCall() bool // next step calls Screen function
+}
+
+type vmMachine struct {
+	*vm.Machine
+	os *vm.OS
+}
+
+func (m vmMachine) run(max uint64) (uint64, error) { return m.Run(max) }
+func (m vmMachine) stopped() bool                  { return m.Status != vm.Running }
+func (m vmMachine) failed() (int16, bool)          { return m.ErrorCode, m.Status == vm.Failed }
+func (m vmMachine) ram() []int16                   { return m.RAM[:] }
+func (m vmMachine) text() string                   { return m.os.Text() }
+
+func (m vmMachine) screenCall() bool {
+	if m.PC >= len(m.Program) {
+		return false
+	}
+	c := m.Program[m.PC]
+	return c.Type == vmtranslator.CmdCall && strings.HasPrefix(c.Arg1, "Screen.")
+}
+
+// cpuMachine detects Sys.error by its label, the error code is its argument
+type cpuMachine struct {
+	*cpu.Computer
+	sysError int          // ROM address of Sys.error, -1 if unknown
+	screen   map[int]bool // ROM addresses of Screen functions
+	code     int16
+	error    bool
+}
+
+func (m *cpuMachine) run(max uint64) (uint64, error) {
+	var n uint64
+	for ; n < max && !m.stopped(); n++ {
+		m.Step()
+		if int(m.PC) == m.sysError {
+			m.code = m.RAM[uint16(m.RAM[vm.ARG])&(cpu.RAMSize-1)]
+			m.error = true
+		}
+	}
+	return n, nil
+}
+
+func (m *cpuMachine) stopped() bool         { return m.error || m.Halted() }
+func (m *cpuMachine) failed() (int16, bool) { return m.code, m.error }
+func (m *cpuMachine) ram() []int16          { return m.RAM[:] }
+func (m *cpuMachine) text() string          { return "" }
+func (m *cpuMachine) screenCall() bool      { return m.screen[int(m.PC)] }
+
+func main() {
+	var opts compiler.Options
+	flag.BoolVar(&opts.BoundsCheck, "bounds", false, "compile Jack with array bounds checks")
+	flag.BoolVar(&opts.Debug, "debug", false, "compile Jack with null and zero division checks")
+	maxCycles := flag.Uint64("cycles", 100000000, "stop after `n` cycles, 0 for no limit")
+	maxTime := flag.Duration("time", 0, "stop after `duration`, 0 for no limit")
+	ramRanges := flag.String("ram", "", "dump RAM `ranges` after the run, as in 256-260,16384")
+	output := flag.Bool("output", false, "print text of Output (VM only)")
+	pngPath := flag.String("png", "", "write screen after the run to PNG `file`")
+	gifPath := flag.String("gif", "", "record screen to animated GIF `file`")
+	every := flag.Uint64("every", 0, "take GIF frame every `n` cycles, 0 for frames on Screen calls")
+	delay := flag.Int("delay", 5, "GIF frame `delay` in 100ths of a second")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: hackrun [-cycles n] [-time duration] [-ram ranges] [-output] [-png file] [-gif file [-every n] [-delay d]] [-bounds] [-debug] /path/to/jackORvmDir|file.vm|file.asm|file.hack")
+	}
+	ranges, e := parseRanges(*ramRanges)
+	if e != nil {
+		log.Fatal(e)
+	}
+	opts.Checks = &compiler.Checks{}
+
+	m, e := load(flag.Arg(0), opts)
+	if e != nil {
+		log.Print(e)
+		os.Exit(exitBuild)
+	}
+
+	var rec *screen.Recorder
+	if *gifPath != "" {
+		rec = &screen.Recorder{Delay: *delay}
+	}
+
+	status, cycles := execute(m, *maxCycles, *maxTime, rec, *every)
+	switch code, _ := m.failed(); status {
+	case exitError:
+		log.Printf("Sys.error %d after %d cycles\n", code, cycles)
+		for _, site := range opts.Checks.Sites {
+			if site.Code == int(code) {
+				log.Printf("%s check failed in %s.%s at %s:%d\n", site.Kind, site.Class, site.Fn, site.File, site.Line)
+			}
+		}
+	case exitHalt:
+		log.Printf("halted after %d cycles\n", cycles)
+	case exitCycles:
+		log.Printf("cycle limit reached after %d cycles\n", cycles)
+	case exitTime:
+		log.Printf("time limit reached after %d cycles\n", cycles)
+	}
+
+	if *pngPath != "" {
+		writeFile(*pngPath, func(w io.Writer) error { return screen.WritePNG(w, m.ram()) })
+	}
+	if rec != nil {
+		rec.Add(m.ram())
+		writeFile(*gifPath, rec.WriteGIF)
+		log.Printf("%d frames recorded\n", rec.Frames())
+	}
+	if *output {
+		fmt.Println(m.text())
+	}
+	ram := m.ram()
+	for _, r := range ranges {
+		for i := r[0]; i <= r[1]; i++ {
+			fmt.Printf("RAM[%d] = %d\n", i, ram[i])
+		}
+	}
+	os.Exit(status)
+}
+
+// execute runs m until it stops or reaches a limit, 0 for none; frames are recorded to rec
+// if not nil, every n cycles or on Screen calls if every is 0. Returns exit status and cycles run
+func execute(m machine, maxCycles uint64, maxTime time.Duration, rec *screen.Recorder, every uint64) (int, uint64) {
+	status := exitHalt
+	start := time.Now()
+	var cycles uint64
+	for !m.stopped() {
+		if maxCycles > 0 && cycles >= maxCycles {
+			status = exitCycles
+			break
+		}
+		if maxTime > 0 && cycles%chunk == 0 && time.Since(start) >= maxTime {
+			status = exitTime
+			break
+		}
+		// frames are taken between single steps
+		n := chunk - cycles%chunk
+		if rec != nil {
+			n = 1
+			if every > 0 && cycles%every == 0 || every == 0 && m.screenCall() {
+				rec.Add(m.ram())
+			}
+		}
+		if maxCycles > 0 && maxCycles-cycles < n {
+			n = maxCycles - cycles
+		}
+		done, e := m.run(n)
+		cycles += done
+		if e != nil {
+			log.Print(e)
+			status = exitFault
+			break
+		}
+	}
+	if _, failed := m.failed(); failed {
+		status = exitError
+	}
+	return status, cycles
+}
+
+func writeFile(path string, write func(w io.Writer) error) {
+	f, e := os.Create(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer f.Close()
+	if e := write(f); e != nil {
+		log.Fatal(e)
+	}
+}
+
+// load builds program, VM code runs on the VM emulator, ASM and HACK on the CPU emulator
+func load(path string, opts compiler.Options) (machine, error) {
+	p, e := program.Load(path, opts)
+	if e != nil {
+		return nil, e
+	}
+	if p.VM != nil {
+		return vmMachine{p.VM, p.OS}, nil
+	}
+	m := &cpuMachine{Computer: p.CPU, sysError: -1, screen: map[int]bool{}}
+	if addr, ok := p.Symbols.Labels["Sys.error"]; ok {
+		m.sysError = addr
+	}
+	for name, addr := range p.Symbols.Labels {
+		if strings.HasPrefix(name, "Screen.") && !strings.Contains(name, "$") {
+			m.screen[addr] = true
+		}
+	}
+	return m, nil
+}
+
+// parseRanges reads comma separated addresses and first-last ranges
+func parseRanges(s string) ([][2]int, error) {
+	var ranges [][2]int
+	if s == "" {
+		return nil, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		var r [2]int
+		for i := range r {
+			b := bounds[len(bounds)-1]
+			if i == 0 {
+				b = bounds[0]
+			}
+			v, e := strconv.Atoi(strings.TrimSpace(b))
+			if e != nil || v < 0 || v >= cpu.RAMSize {
+				return nil, fmt.Errorf("bad RAM range '%s'", part)
+			}
+			r[i] = v
+		}
+		if r[0] > r[1] {
+			return nil, fmt.Errorf("bad RAM range '%s'", part)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
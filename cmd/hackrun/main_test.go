@@ -0,0 +1,74 @@
+package main
+
+import (
+	"git.andmed.org/nand2tetris/compiler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRanges(t *testing.T) {
+	ranges, e := parseRanges("256-260, 16384,0-0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if want := [][2]int{{256, 260}, {16384, 16384}, {0, 0}}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("got %v", ranges)
+	}
+	if ranges, e := parseRanges(""); e != nil || ranges != nil {
+		t.Errorf("empty: %v %v", ranges, e)
+	}
+	for _, s := range []string{"x", "5-2", "-1", "32768", "1-2-3"} {
+		if _, e := parseRanges(s); e == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir, e := ioutil.TempDir("", "hackrun")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"Divide.vm": "function Main.main 0\npush constant 1\npush constant 0\ncall Math.divide 2\nreturn\n",
+		"Loop.vm":   "function Main.main 0\nlabel LOOP\npush constant 1\npop temp 0\ngoto LOOP\n",
+		"Error.asm": "@Sys.error\n0;JMP\n(Sys.error)\n@Sys.error\n0;JMP\n",
+		"Halt.hack": "0000000000000000\n1110101010000111\n",
+	}
+	for name, s := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644)
+	}
+	for _, test := range []struct {
+		path   string
+		cycles uint64
+		time   time.Duration
+		status int
+	}{
+		{"../../compiler/test/Seven", 0, 0, exitHalt},
+		{filepath.Join(dir, "Divide.vm"), 0, 0, exitError},
+		{filepath.Join(dir, "Loop.vm"), 1000, 0, exitCycles},
+		{filepath.Join(dir, "Loop.vm"), 0, time.Nanosecond, exitTime},
+		{filepath.Join(dir, "Error.asm"), 1000, 0, exitError},
+		{filepath.Join(dir, "Halt.hack"), 1000, 0, exitHalt},
+	} {
+		m, e := load(test.path, compiler.Options{Checks: &compiler.Checks{}})
+		if e != nil {
+			t.Fatal(e)
+		}
+		status, cycles := execute(m, test.cycles, test.time, nil, 0)
+		if status != test.status {
+			t.Errorf("%s: status %d after %d cycles, want %d", test.path, status, cycles, test.status)
+		}
+		if test.status == exitCycles && cycles != test.cycles {
+			t.Errorf("%s: %d cycles", test.path, cycles)
+		}
+	}
+	if _, e := load(filepath.Join(dir, "Missing.vm"), compiler.Options{}); e == nil {
+		t.Error("missing file loaded")
+	}
+}
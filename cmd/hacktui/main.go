@@ -0,0 +1,247 @@
+// Command hacktui runs a program in the terminal: screen drawn with Unicode characters,
+// key presses go to the keyboard register, side panel shows registers, function and stack
+package main
+
+import (
+	"flag"
+	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/program"
+	"git.andmed.org/nand2tetris/tui"
+	"git.andmed.org/nand2tetris/vm"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stack values shown in the panel
+const stackLines = 10
+
+// cycles run between checks for Sys.wait
+const chunk = 1000
+
+type machine interface {
+	run(max uint64) error
+	stopped() bool
+	ram() []int16
+	setKey(code int16)
+	panel() []string
+}
+
+type vmMachine struct {
+	*vm.Machine
+	pause int // ms left to wait by Sys.wait
+}
+
+func (m *vmMachine) run(max uint64) error {
+	for n := uint64(0); n < max && m.pause <= 0 && m.Status == vm.Running; n += chunk {
+		if _, e := m.Run(chunk); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (m *vmMachine) stopped() bool     { return m.Status != vm.Running }
+func (m *vmMachine) ram() []int16      { return m.RAM[:] }
+func (m *vmMachine) setKey(code int16) { m.RAM[vm.Keyboard] = code }
+
+func (m *vmMachine) panel() []string {
+	lines := []string{
+		fmt.Sprintf("PC %-6d cycles %d", m.PC, m.Cycles),
+		status(m.Status == vm.Halted, m.Status == vm.Failed, m.ErrorCode),
+		"function " + m.Function(),
+	}
+	lines = append(lines, pointers(m.RAM[:])...)
+	lines = append(lines, stack(m.RAM[:])...)
+	lines = append(lines, "frames")
+	for i := len(m.Frames) - 1; i >= 0 && len(lines) < 40; i-- {
+		lines = append(lines, "  "+m.Frames[i].Function)
+	}
+	return lines
+}
+
+type cpuMachine struct {
+	*cpu.Computer
+	functions []int // ROM addresses of function labels, sorted
+	names     map[int]string
+}
+
+func (m *cpuMachine) run(max uint64) error {
+	m.Run(max)
+	return nil
+}
+
+func (m *cpuMachine) stopped() bool     { return m.Halted() }
+func (m *cpuMachine) ram() []int16      { return m.RAM[:] }
+func (m *cpuMachine) setKey(code int16) { m.SetKey(code) }
+
+func (m *cpuMachine) panel() []string {
+	lines := []string{
+		fmt.Sprintf("PC %-6d cycles %d", m.PC, m.Cycles),
+		fmt.Sprintf("A  %-6d D %d", m.A, m.D),
+		status(m.Halted(), false, 0),
+		"function " + m.function(),
+	}
+	lines = append(lines, pointers(m.RAM[:])...)
+	return append(lines, stack(m.RAM[:])...)
+}
+
+// function returns name of the nearest function label at or before PC
+func (m *cpuMachine) function() string {
+	i := sort.SearchInts(m.functions, int(m.PC)+1) - 1
+	if i < 0 {
+		return ""
+	}
+	return m.names[m.functions[i]]
+}
+
+func status(halted, failed bool, code int16) string {
+	switch {
+	case failed:
+		return fmt.Sprintf("ERROR %d", code)
+	case halted:
+		return "halted"
+	}
+	return "running"
+}
+
+func pointers(ram []int16) []string {
+	return []string{
+		fmt.Sprintf("SP   %-6d LCL  %d", ram[vm.SP], ram[vm.LCL]),
+		fmt.Sprintf("ARG  %-6d THIS %d", ram[vm.ARG], ram[vm.THIS]),
+		fmt.Sprintf("THAT %d", ram[vm.THAT]),
+	}
+}
+
+// stack returns top values of the stack
+func stack(ram []int16) []string {
+	lines := []string{"stack"}
+	sp := int(ram[vm.SP])
+	for addr := sp - 1; addr >= vm.Stack && addr >= sp-stackLines && addr < len(ram); addr-- {
+		lines = append(lines, fmt.Sprintf("  %5d: %d", addr, ram[addr]))
+	}
+	return lines
+}
+
+func main() {
+	mode := flag.String("mode", "braille", "screen drawing `mode`, braille or half")
+	scale := flag.Int("scale", 2, "pixels per dot along each side")
+	fps := flag.Int("fps", 30, "frames per second")
+	speed := flag.Uint64("speed", 100000, "cycles per frame")
+	hold := flag.Duration("hold", 150*time.Millisecond, "time key is held after press")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: hacktui [-mode braille|half] [-scale n] [-fps n] [-speed cycles] [-hold duration] /path/to/jackORvmDir|file.vm|file.asm|file.hack")
+	}
+	drawMode := tui.Braille
+	if *mode == "half" {
+		drawMode = tui.HalfBlock
+	}
+
+	m, e := load(flag.Arg(0))
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	restore, e := tui.Raw()
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer restore()
+
+	input := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, e := os.Stdin.Read(buf)
+			if e != nil {
+				close(input)
+				return
+			}
+			input <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	kb := tui.Keyboard{Hold: *hold}
+	frame := time.Second / time.Duration(*fps)
+	ticker := time.NewTicker(frame)
+	defer ticker.Stop()
+	var fault error
+	for now := range ticker.C {
+		if !readKeys(input, &kb, now) {
+			break
+		}
+		m.setKey(kb.Code(now))
+		if vmm, ok := m.(*vmMachine); ok && vmm.pause > 0 {
+			vmm.pause -= int(frame / time.Millisecond)
+		}
+		if !m.stopped() && fault == nil {
+			fault = m.run(*speed)
+		}
+		panel := append(m.panel(), "", "Ctrl-Q quits")
+		if fault != nil {
+			panel = append(panel, fault.Error())
+		}
+		os.Stdout.WriteString(tui.Layout(tui.Render(m.ram(), drawMode, *scale), panel))
+	}
+}
+
+// readKeys takes pending input, false on Ctrl-C, Ctrl-Q or end of input
+func readKeys(input chan []byte, kb *tui.Keyboard, now time.Time) bool {
+	for {
+		select {
+		case in, ok := <-input:
+			if !ok {
+				return false
+			}
+			for len(in) > 0 {
+				if in[0] == 0x03 || in[0] == 0x11 {
+					return false
+				}
+				code, n := tui.DecodeKey(in)
+				if code != 0 {
+					kb.Press(code, now)
+				}
+				in = in[n:]
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// load builds program, VM code runs with Go OS, ASM and HACK on the CPU
+func load(path string) (machine, error) {
+	p, e := program.Load(path, compiler.Options{})
+	if e != nil {
+		return nil, e
+	}
+	if p.VM != nil {
+		m := &vmMachine{Machine: p.VM}
+		p.OS.Sleep = func(ms int) { m.pause += ms }
+		return m, nil
+	}
+	m := &cpuMachine{Computer: p.CPU, names: map[int]string{}}
+	m.functionLabels(p.Symbols)
+	return m, nil
+}
+
+// functionLabels keeps labels of translated VM functions, Class.name without '$'
+func (m *cpuMachine) functionLabels(syms assembler.Symbols) {
+	for name, addr := range syms.Labels {
+		if strings.Contains(name, ".") && !strings.Contains(name, "$") {
+			if old, ok := m.names[addr]; !ok || name < old {
+				m.names[addr] = name
+			}
+		}
+	}
+	for addr := range m.names {
+		m.functions = append(m.functions, addr)
+	}
+	sort.Ints(m.functions)
+}
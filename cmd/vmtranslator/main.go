@@ -1,27 +1,41 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
 	"git.andmed.org/nand2tetris/vmtranslator"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
-
-	if len(os.Args) != 2 {
-		log.Fatal("Usage: vmtranslator /path/to/fileORdir")
+	osDirs := flag.String("os", "", "OS `dirs` with .vm files resolving undefined calls, separated by '"+string(os.PathListSeparator)+"'")
+	bootstrap := flag.Bool("bootstrap", true, "add bootstrap code calling Sys.init")
+	strict := flag.Bool("strict", false, "fail on calls of undefined functions without -os too")
+	dead := flag.Bool("dead", false, "remove functions not reachable by calls from Sys.init")
+	keep := flag.String("keep", "", "comma separated `functions` kept with -dead")
+	compact := flag.Bool("compact", false, "call shared call, return and comparison routines, smaller but slower")
+	optimize := flag.Bool("O", false, "remove redundant instructions with peephole optimization")
+	size := flag.Bool("size", false, "write estimated ROM words by function and file to stderr")
+	budget := flag.Int("budget", assembler.ROMSize, "fail when estimated ROM `words` exceed it")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: vmtranslator [-os dirs] [-bootstrap=false] [-strict] [-compact] [-O] [-dead [-keep functions]] [-size] [-budget words] /path/to/fileORdir")
 	}
-	path := os.Args[1]
+	path := flag.Arg(0)
 
 	stat, e := os.Stat(path)
 	if e != nil {
 		log.Fatal(e)
 	}
 
-	b := vmtranslator.VMTranslator{}
-	vmtranslator.Bootstrap(&b)
+	b := vmtranslator.VMTranslator{Compact: *compact}
+	if *bootstrap {
+		vmtranslator.Bootstrap(&b)
+	}
 
 	var files, lines, exitCode int
 	var ok bool
@@ -43,6 +57,42 @@ func main() {
 			exitCode = 1
 		}
 	}
+	if *osDirs != "" {
+		line, ok := vmtranslator.TranslateOS(&b, filepath.SplitList(*osDirs))
+		lines += line
+		if !ok {
+			exitCode = 1
+		}
+	}
+	vmtranslator.Routines(&b)
+	for _, e := range b.Check() {
+		// without OS undefined functions are expected to come from OS files translated separately
+		if _, ok := e.(*vmtranslator.UndefinedError); ok && *osDirs == "" && !*strict {
+			log.Println("warning:", e)
+			continue
+		}
+		log.Println(e)
+		exitCode = 1
+	}
+	if *dead {
+		var kept []string
+		if *keep != "" {
+			kept = strings.Split(*keep, ",")
+		}
+		removed, saved := b.Eliminate(kept...)
+		log.Printf("Removed %d unreachable functions, saved %d ROM words.\n", len(removed), saved)
+	}
+	if *optimize {
+		log.Printf("Removed %d redundant instructions.\n", b.Optimize())
+	}
+	sizes := b.Sizes()
+	if *size {
+		assembler.WriteSizes(os.Stderr, sizes, *budget)
+	}
+	if e := assembler.CheckSize(assembler.Total(sizes), *budget); e != nil {
+		log.Println(e)
+		exitCode = 1
+	}
 
 	fmt.Print(b.String())
 	log.Printf("Total %d lines in %d VM files processed.\n", lines, files)
@@ -0,0 +1,258 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CallGraph is a whole program graph of subroutine calls, nodes are 'Class.subroutine'
+type CallGraph struct {
+	defined map[string]bool
+	edges   map[string]map[string]bool
+	current string // function of the last VM line read
+}
+
+// NewCallGraph returns empty graph to be filled by compiling files with Options.Graph
+func NewCallGraph() *CallGraph {
+	return &CallGraph{
+		defined: map[string]bool{},
+		edges:   map[string]map[string]bool{},
+	}
+}
+
+// read takes emitted VM code, so calls the compiler adds and calls in vm blocks
+// are edges too: function defines a node, call adds an edge from it
+func (g *CallGraph) read(code string) {
+	for _, line := range strings.Split(code, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "function":
+			g.current = fields[1]
+			g.define(fields[1])
+		case "call":
+			g.call(g.current, fields[1])
+		}
+	}
+}
+
+func (g *CallGraph) define(fn string) {
+	g.defined[fn] = true
+}
+
+func (g *CallGraph) call(from, to string) {
+	if g.edges[from] == nil {
+		g.edges[from] = map[string]bool{}
+	}
+	g.edges[from][to] = true
+}
+
+// Nodes returns all subroutines, defined or called, sorted
+func (g *CallGraph) Nodes() []string {
+	all := map[string]bool{}
+	for fn := range g.defined {
+		all[fn] = true
+	}
+	for from, to := range g.edges {
+		all[from] = true
+		for fn := range to {
+			all[fn] = true
+		}
+	}
+	return sorted(all)
+}
+
+// Callees returns subroutines called from fn, sorted
+func (g *CallGraph) Callees(fn string) []string {
+	return sorted(g.edges[fn])
+}
+
+// Reachable returns set of subroutines called directly or indirectly from roots
+func (g *CallGraph) Reachable(roots ...string) map[string]bool {
+	seen := map[string]bool{}
+	var visit func(fn string)
+	visit = func(fn string) {
+		if seen[fn] {
+			return
+		}
+		seen[fn] = true
+		for to := range g.edges[fn] {
+			visit(to)
+		}
+	}
+	for _, fn := range roots {
+		visit(fn)
+	}
+	return seen
+}
+
+// Unreachable returns defined subroutines never called from roots
+func (g *CallGraph) Unreachable(roots ...string) []string {
+	reachable := g.Reachable(roots...)
+	var fns []string
+	for _, fn := range sorted(g.defined) {
+		if !reachable[fn] {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
+
+// Cycles returns groups of mutually recursive subroutines (Tarjan's strongly connected components)
+func (g *CallGraph) Cycles() [][]string {
+	var (
+		index   = map[string]int{}
+		low     = map[string]int{}
+		onStack = map[string]bool{}
+		stack   []string
+		cycles  [][]string
+	)
+	var connect func(fn string)
+	connect = func(fn string) {
+		index[fn] = len(index)
+		low[fn] = index[fn]
+		stack = append(stack, fn)
+		onStack[fn] = true
+		for _, to := range g.Callees(fn) {
+			if _, ok := index[to]; !ok {
+				connect(to)
+				if low[to] < low[fn] {
+					low[fn] = low[to]
+				}
+			} else if onStack[to] && index[to] < low[fn] {
+				low[fn] = index[to]
+			}
+		}
+		if low[fn] != index[fn] {
+			return
+		}
+		var group []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			group = append(group, top)
+			if top == fn {
+				break
+			}
+		}
+		if len(group) > 1 || g.edges[fn][fn] {
+			sort.Strings(group)
+			cycles = append(cycles, group)
+		}
+	}
+	for _, fn := range g.Nodes() {
+		if _, ok := index[fn]; !ok {
+			connect(fn)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// WriteDOT outputs graph in Graphviz format: unreachable subroutines are gray,
+// not compiled (OS) ones dashed, recursive calls red
+func (g *CallGraph) WriteDOT(w io.Writer, roots ...string) error {
+	reachable := g.Reachable(roots...)
+	recursive := g.recursive()
+	if _, e := fmt.Fprintln(w, "digraph calls {"); e != nil {
+		return e
+	}
+	for _, fn := range g.Nodes() {
+		var attr string
+		switch {
+		case !g.defined[fn]:
+			attr = " [style=dashed]"
+		case !reachable[fn]:
+			attr = " [color=gray, fontcolor=gray]"
+		}
+		fmt.Fprintf(w, "\t%q%s;\n", fn, attr)
+	}
+	for _, from := range g.Nodes() {
+		for _, to := range g.Callees(from) {
+			var attr string
+			if recursive[from] != 0 && recursive[from] == recursive[to] {
+				attr = " [color=red]"
+			}
+			fmt.Fprintf(w, "\t%q -> %q%s;\n", from, to, attr)
+		}
+	}
+	_, e := fmt.Fprintln(w, "}")
+	return e
+}
+
+type jsonNode struct {
+	Name      string `json:"name"`
+	Defined   bool   `json:"defined"`
+	Reachable bool   `json:"reachable"`
+	Recursive bool   `json:"recursive"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type jsonGraph struct {
+	Nodes       []jsonNode `json:"nodes"`
+	Edges       []jsonEdge `json:"edges"`
+	Unreachable []string   `json:"unreachable"`
+	Cycles      [][]string `json:"cycles"`
+}
+
+// WriteJSON outputs graph with reachability from roots and recursive cycles
+func (g *CallGraph) WriteJSON(w io.Writer, roots ...string) error {
+	reachable := g.Reachable(roots...)
+	recursive := g.recursive()
+	out := jsonGraph{
+		Nodes:       []jsonNode{},
+		Edges:       []jsonEdge{},
+		Unreachable: g.Unreachable(roots...),
+		Cycles:      g.Cycles(),
+	}
+	for _, fn := range g.Nodes() {
+		out.Nodes = append(out.Nodes, jsonNode{
+			Name:      fn,
+			Defined:   g.defined[fn],
+			Reachable: reachable[fn],
+			Recursive: recursive[fn] != 0,
+		})
+		for _, to := range g.Callees(fn) {
+			out.Edges = append(out.Edges, jsonEdge{From: fn, To: to})
+		}
+	}
+	if out.Unreachable == nil {
+		out.Unreachable = []string{}
+	}
+	if out.Cycles == nil {
+		out.Cycles = [][]string{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// recursive maps subroutines to 1-based number of their cycle
+func (g *CallGraph) recursive() map[string]int {
+	m := map[string]int{}
+	for i, cycle := range g.Cycles() {
+		for _, fn := range cycle {
+			m[fn] = i + 1
+		}
+	}
+	return m
+}
+
+func sorted(set map[string]bool) []string {
+	var s []string
+	for k := range set {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
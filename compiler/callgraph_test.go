@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testGraph(t *testing.T, sources ...string) *CallGraph {
+	g := NewCallGraph()
+	for _, src := range sources {
+		cr := newSourceCompiler([]byte(src), &bytes.Buffer{})
+		cr.opts.Graph = g
+		cr.Compile()
+	}
+	return g
+}
+
+func TestCallGraph(t *testing.T) {
+	g := testGraph(t, `class Main {
+  function void main() { var Foo f; let f = Foo.new(); do f.loop(3); return; }
+  function void unused() { do Main.unused(); return; }
+}`, `class Foo {
+  constructor Foo new() { return this; }
+  method void loop(int n) { do ping(n); return; }
+  method void ping(int n) { do pong(n); return; }
+  method void pong(int n) { do ping(n); do Output.printInt(n); return; }
+}`)
+	if callees := g.Callees("Main.main"); !reflect.DeepEqual(callees, []string{"Foo.loop", "Foo.new"}) {
+		t.Fatalf("variable call not resolved: %v", callees)
+	}
+	if u := g.Unreachable("Main.main", "Sys.init"); !reflect.DeepEqual(u, []string{"Main.unused"}) {
+		t.Fatalf("unreachable %v", u)
+	}
+	expected := [][]string{{"Foo.ping", "Foo.pong"}, {"Main.unused"}}
+	if c := g.Cycles(); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("cycles %v", c)
+	}
+
+	dot := bytes.Buffer{}
+	g.WriteDOT(&dot, "Main.main")
+	for _, s := range []string{
+		"\"Output.printInt\" [style=dashed];",
+		"\"Main.unused\" [color=gray, fontcolor=gray];",
+		"\"Foo.ping\" -> \"Foo.pong\" [color=red];",
+		"\"Foo.pong\" -> \"Output.printInt\";",
+	} {
+		if !strings.Contains(dot.String(), s) {
+			t.Fatalf("missing %s in\n%s", s, dot.String())
+		}
+	}
+
+	js := bytes.Buffer{}
+	g.WriteJSON(&js, "Main.main")
+	var out jsonGraph
+	if e := json.Unmarshal(js.Bytes(), &out); e != nil {
+		t.Fatal(e)
+	}
+	if len(out.Nodes) != 8 || len(out.Edges) != 8 || len(out.Cycles) != 2 {
+		t.Fatalf("unexpected json\n%s", js.String())
+	}
+}
+
+func TestCallGraphImplicit(t *testing.T) {
+	g := testGraph(t, `class Main {
+  function void main() { var int x; let x = Main.f(3) * x / x; do Main.g(); return; }
+  function int f(int x) { var String s; let s = "a"; return x; }
+  function void g() { vm {
+    push constant 1
+    call Main.h 1 // not called from Jack
+    pop temp 0
+  } return; }
+  function void h(int x) { return; }
+}`)
+	expected := []string{"Main.f", "Main.g", "Math.divide", "Math.multiply"}
+	if callees := g.Callees("Main.main"); !reflect.DeepEqual(callees, expected) {
+		t.Fatalf("Main.main calls %v", callees)
+	}
+	if callees := g.Callees("Main.f"); !reflect.DeepEqual(callees, []string{"String.appendChar", "String.new"}) {
+		t.Fatalf("Main.f calls %v", callees)
+	}
+	if u := g.Unreachable("Main.main"); len(u) != 0 {
+		t.Fatalf("unreachable %v", u)
+	}
+}
+
+func TestCallGraphPong(t *testing.T) {
+	var sources []string
+	for _, name := range []string{"Ball", "Bat", "Main", "PongGame"} {
+		src, e := ioutil.ReadFile("test/Pong/" + name + ".jack")
+		FAIL(e)
+		sources = append(sources, string(src))
+	}
+	g := testGraph(t, sources...)
+	if callees := g.Callees("PongGame.moveBall"); !reflect.DeepEqual(callees[:2], []string{"Ball.bounce", "Ball.getLeft"}) {
+		t.Fatalf("PongGame.moveBall calls %v", callees)
+	}
+	if u := g.Unreachable("Main.main"); len(u) != 0 {
+		t.Fatalf("unreachable %v", u)
+	}
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+)
+
+// first code given to runtime checks, lower ones are used by the OS
+const checkBase = 100
+
+// kinds of runtime checks
+const (
+	CheckBounds = "bounds"
+	CheckNull   = "null"
+	CheckZero   = "zero"
+)
+
+// Check is a runtime check site, its Code is passed to Sys.error on failure
+type Check struct {
+	Code  int
+	Kind  string
+	File  string
+	Class string
+	Fn    string
+	Line  int
+}
+
+// Checks numbers runtime checks of a program
+type Checks struct {
+	Sites []Check
+}
+
+func (c *Checks) add(kind string, cr *compiler) int {
+	file := cr.file
+	if file == "" {
+		file = cr.class + ".jack"
+	}
+	code := checkBase + len(c.Sites)
+	c.Sites = append(c.Sites, Check{
+		Code:  code,
+		Kind:  kind,
+		File:  file,
+		Class: cr.class,
+		Fn:    cr.fn,
+		Line:  cr.stmtLine,
+	})
+	return code
+}
+
+// Write outputs check table, one 'code kind Class.fn file:line' per line
+func (c *Checks) Write(w io.Writer) error {
+	for _, s := range c.Sites {
+		if _, e := fmt.Fprintf(w, "%d %s %s.%s %s:%d\n", s.Code, s.Kind, s.Class, s.Fn, s.File, s.Line); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// check registers check site at current statement, returns its error code
+func (cr *compiler) check(kind string) int {
+	if cr.opts.Checks == nil {
+		cr.opts.Checks = &Checks{}
+	}
+	return cr.opts.Checks.add(kind, cr)
+}
+
+// nonZero checks value on top of stack in debug mode, keeping the value
+func (cr *compiler) nonZero(kind string) {
+	if !cr.opts.Debug {
+		return
+	}
+	cr.pushConst(cr.check(kind))
+	cr.linef("call %s.%s 2", cr.class, helperNonZero)
+	cr.helpers[helperNonZero] = true
+}
+
+// thisCheck checks the object before field access in a method
+func (cr *compiler) thisCheck() {
+	if !cr.opts.Debug || cr.fnMod != _method {
+		return
+	}
+	cr.pushPointer(0)
+	cr.nonZero(CheckNull)
+	cr.popTemp(0)
+}
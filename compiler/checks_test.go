@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestArrayRead(t *testing.T) {
+	expected := "push local 0\npush constant 2\nadd\npop pointer 1\npush that 0\n"
+	testExpString(t, "local[2]", expected)
+}
+
+func TestArrayWrite(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("let local[arg] = 5;", &buf)
+	expected := "push local 0\npush argument 0\nadd\npush constant 5\npop temp 0\npop pointer 1\npush temp 0\npop that 0\n"
+	cr.code(cr.parseLetStmt())
+	if buf.String() != expected {
+		t.Fatalf("RESULT\n%s\nEXPECTING\n%s\n", buf.String(), expected)
+	}
+}
+
+func TestBoundsCheck(t *testing.T) {
+	src := `class Foo {
+  function void main() {
+    var Array a;
+    let a = Array.new(3);
+    let a[1] = a[0];
+    do a.dispose();
+    return;
+  }
+}`
+	buf := bytes.Buffer{}
+	cr := newSourceCompiler([]byte(src), &buf)
+	cr.opts.BoundsCheck = true
+	cr.Compile()
+	out := buf.String()
+	for _, s := range []string{
+		"call Foo.$anew 1\n",
+		"push local 0\npush constant 1\npush constant 100\ncall Foo.$aidx 3\n",
+		"push local 0\npush constant 0\npush constant 101\ncall Foo.$aidx 3\npop pointer 1\npush that 0\n",
+		"push local 0\ncall Foo.$adispose 1\n",
+		"function Foo.$aidx 0\n",
+		"function Foo.$anew 0\n",
+		"function Foo.$adispose 0\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("missing\n%s\nin\n%s", s, out)
+		}
+	}
+
+	table := bytes.Buffer{}
+	cr.opts.Checks.Write(&table)
+	expected := "100 bounds Foo.main Foo.jack:5\n101 bounds Foo.main Foo.jack:5\n"
+	if table.String() != expected {
+		t.Fatalf("RESULT\n%s\nEXPECTING\n%s\n", table.String(), expected)
+	}
+}
+
+func TestDebugChecks(t *testing.T) {
+	src := `class Foo {
+  field int x;
+  method int get(Foo other, int d) {
+    do other.run();
+    let x = x / d;
+    return x;
+  }
+}`
+	buf := bytes.Buffer{}
+	cr := newSourceCompiler([]byte(src), &buf)
+	cr.opts.Debug = true
+	cr.Compile()
+	out := buf.String()
+	for _, s := range []string{
+		"push argument 1\npush constant 100\ncall Foo.$nz 2\ncall Foo.run 1\n",
+		"push pointer 0\npush constant 101\ncall Foo.$nz 2\npop temp 0\npush this 0\n",
+		"push argument 2\npush constant 102\ncall Foo.$nz 2\ncall Math.divide 2\n",
+		"push pointer 0\npush constant 103\ncall Foo.$nz 2\npop temp 0\npop this 0\n",
+		"function Foo.$nz 0\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("missing\n%s\nin\n%s", s, out)
+		}
+	}
+
+	table := bytes.Buffer{}
+	cr.opts.Checks.Write(&table)
+	expected := `100 null Foo.get Foo.jack:4
+101 null Foo.get Foo.jack:5
+102 zero Foo.get Foo.jack:5
+103 null Foo.get Foo.jack:5
+104 null Foo.get Foo.jack:6
+`
+	if table.String() != expected {
+		t.Fatalf("RESULT\n%s\nEXPECTING\n%s\n", table.String(), expected)
+	}
+}
+
+func TestDivideCallCheck(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("Math.divide(local, arg)", &buf)
+	cr.opts.Debug = true
+	cr.code(cr.parseExpr())
+	expected := "push local 0\npush argument 0\npush constant 100\ncall Test.$nz 2\ncall Math.divide 2\n"
+	if buf.String() != expected {
+		t.Fatalf("RESULT\n%s\nEXPECTING\n%s\n", buf.String(), expected)
+	}
+	if cr.opts.Checks.Sites[0].Kind != CheckZero {
+		t.Fatalf("check %v", cr.opts.Checks.Sites)
+	}
+}
+
+func TestNoChecksInFunction(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("let field = 1;", &buf)
+	cr.opts.Debug = true
+	cr.fnMod = _function
+	cr.code(cr.parseLetStmt())
+	if buf.String() != "push constant 1\npop this 0\n" {
+		t.Fatalf("unexpected check\n%s", buf.String())
+	}
+}
@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"git.andmed.org/nand2tetris/vmtranslator"
 	"io"
 	"reflect"
 	"strings"
@@ -27,6 +28,8 @@ const (
 	_int         = "int"
 	_char        = "char"
 	_boolean     = "boolean"
+	_vm          = "vm"
+	_asm         = "asm"
 )
 
 func (cr *compiler) code(token interface{}) { // fixme double cases
@@ -47,9 +50,21 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 			cr.code(stmt)
 		}
 		cr.line("label " + ifend)
+	case stmtToken:
+		cr.stmtLine = t.line
+		cr.code(t.stmt)
 	case letStmtToken:
+		if t.index.left == nil {
+			cr.code(t.exp)
+			cr.popVar(cr, t.name)
+			break
+		}
+		cr.element(t.name, t.index)
 		cr.code(t.exp)
-		cr.popVar(cr, t.name)
+		cr.popTemp(0)
+		cr.line("pop pointer 1")
+		cr.pushTemp(0)
+		cr.popThat(0)
 	case whileStmtToken:
 		start := cr.nextLabel("while_start")
 		end := cr.nextLabel("while_end")
@@ -66,6 +81,14 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 	case doStmtToken:
 		cr.code(t.stmt)
 		cr.popTemp(0) // discard result
+	case vmBlockToken:
+		for _, line := range t.lines {
+			line = cr.resolveVM(line)
+			if e := vmtranslator.Validate(line); e != nil {
+				fail(cr.r, "%s in vm block: '%s'", e, line)
+			}
+			cr.line(line)
+		}
 	case returnStmtToken:
 		if t.exp.left == nil {
 			cr.pushConst(0)
@@ -74,6 +97,9 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 		}
 		cr.line("return")
 	case fnToken:
+		cr.fn = t.name
+		cr.fnMod = t.mod
+		cr.stmtLine = t.line
 		cr.clearlocals()
 		if t.mod == _method {
 			cr.addArg(cr.class, "this")
@@ -88,6 +114,7 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 		for _, v := range t.body.vars {
 			cr.code(v)
 		}
+		cr.mapFunction()
 		cr.linef("function %s.%s %d", cr.class, t.name, cr.localN())
 		if t.mod == _method {
 			cr.pushArg(0)
@@ -124,16 +151,26 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 			// calling var
 			class = typ
 			cr.pushVar(cr, t.name)
+			cr.nonZero(CheckNull)
 			argsN++
 		}
 		for _, exp := range t.exprs {
 			cr.code(exp)
 		}
+		if class == "Math" && t.fn == "divide" && argsN == 2 {
+			cr.nonZero(CheckZero) // same as operator /
+		}
+		if cr.opts.BoundsCheck && class == "Array" {
+			class, t.fn = cr.arrayHelper(t.fn)
+		}
 		cr.linef("call %s.%s %d", class, t.fn, argsN)
 	case expression:
 		if t.left == nil {
 			break
 		}
+		if cr.opts.Optimize && cr.reduce(t) {
+			break
+		}
 		cr.code(t.left)
 		if t.right == nil {
 			break
@@ -147,6 +184,7 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 		case '*':
 			cr.line("call Math.multiply 2")
 		case '/':
+			cr.nonZero(CheckZero)
 			cr.line("call Math.divide 2")
 		case '&':
 			cr.line("and")
@@ -183,6 +221,10 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 		}
 	case varTerm:
 		cr.pushVar(cr, t.string)
+	case arrayTerm:
+		cr.element(t.name, t.index)
+		cr.line("pop pointer 1")
+		cr.pushThat(0)
 	case unaryOpTerm:
 		cr.code(t.term)
 		switch t.byte {
@@ -199,12 +241,29 @@ func (cr *compiler) code(token interface{}) { // fixme double cases
 	}
 }
 
+// element pushes address of array element, checked in bounds check mode
+func (cr *compiler) element(name string, index expression) {
+	cr.pushVar(cr, name)
+	cr.code(index)
+	if !cr.opts.BoundsCheck {
+		cr.line("add")
+		return
+	}
+	cr.pushConst(cr.check(CheckBounds))
+	cr.linef("call %s.%s 3", cr.class, helperIndex)
+	cr.helpers[helperIndex] = true
+}
+
 func (cr compiler) line(s string) {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return
 	}
 	io.WriteString(cr.w, s+"\n")
+	cr.mapLines(strings.Count(s, "\n") + 1)
+	if cr.opts.Graph != nil {
+		cr.opts.Graph.read(s)
+	}
 }
 func (cr compiler) linef(s ...interface{}) {
 	if len(s) < 2 {
@@ -214,7 +273,12 @@ func (cr compiler) linef(s ...interface{}) {
 	if !strings.HasSuffix(format, "\n") {
 		format += "\n"
 	}
-	io.WriteString(cr.w, fmt.Sprintf(format, s[1:]...))
+	out := fmt.Sprintf(format, s[1:]...)
+	io.WriteString(cr.w, out)
+	cr.mapLines(strings.Count(out, "\n"))
+	if cr.opts.Graph != nil {
+		cr.opts.Graph.read(out)
+	}
 }
 func w(s ...interface{}) string {
 	format := s[0].(string) + "\n"
@@ -281,6 +345,7 @@ func (cr *compiler) pushVar(comp *compiler, name string) {
 	case regArg:
 		cr.pushArg(i)
 	case regField:
+		cr.thisCheck()
 		cr.pushThis(i)
 	case regStatic:
 		cr.pushStatic(i)
@@ -296,6 +361,7 @@ func (cr *compiler) popVar(comp *compiler, name string) {
 	case regArg:
 		cr.popArg(i)
 	case regField:
+		cr.thisCheck()
 		cr.popThis(i)
 	case regStatic:
 		cr.popStatic(i)
@@ -303,3 +369,29 @@ func (cr *compiler) popVar(comp *compiler, name string) {
 		fail(cr.r, "var undefined %s", name)
 	}
 }
+
+// resolveVM replaces jack variable in 'push name' / 'pop name' with its segment and index
+func (cr *compiler) resolveVM(line string) string {
+	tokens := strings.Fields(line)
+	if len(tokens) != 2 || (tokens[0] != "push" && tokens[0] != "pop") {
+		return line
+	}
+	reg, _, i := cr.getvar(tokens[1])
+	var segment string
+	switch reg {
+	case regLocal:
+		segment = "local"
+	case regArg:
+		segment = "argument"
+	case regField:
+		if cr.fnMod == _function {
+			fail(cr.r, "field %s in function", tokens[1])
+		}
+		segment = "this"
+	case regStatic:
+		segment = "static"
+	default:
+		fail(cr.r, "var undefined %s", tokens[1])
+	}
+	return fmt.Sprintf("%s %s %d", tokens[0], segment, i)
+}
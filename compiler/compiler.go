@@ -2,20 +2,42 @@ package compiler
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type compiler struct {
 	class      string
+	fn         string // current subroutine
+	fnMod      string // constructor, function or method
+	file       string
 	r          *bufio.Reader
 	w          io.Writer
+	src        []byte        // whole source if known, for line numbers
+	sr         *bytes.Reader // reader under r
+	newlines   []int         // offsets of newlines in src
+	stmtLine   int           // line of current statement
 	vars       []variable
 	labelIndex int
+	opts       Options
+	helpers    map[string]bool // runtime helpers to append to the class
+}
+
+// Options tune code generation
+type Options struct {
+	Optimize    bool       // strength reduction of multiplication and division by constants
+	BoundsCheck bool       // check array index on every access, of arrays from Array.new compiled with it
+	Debug       bool       // check for null objects and zero divisors
+	Checks      *Checks    // numbers runtime checks, share between files of one program
+	Graph       *CallGraph // collects subroutine calls if set
+	Source      *SourceMap // collects Jack lines and symbols of VM code if set
 }
 
 type variable struct {
@@ -35,8 +57,22 @@ const (
 
 func newCompiler(r *bufio.Reader, w io.Writer) compiler {
 	c := compiler{
-		r: r,
-		w: w,
+		r:       r,
+		w:       w,
+		helpers: map[string]bool{},
+	}
+	return c
+}
+
+func newSourceCompiler(src []byte, w io.Writer) compiler {
+	sr := bytes.NewReader(src)
+	c := newCompiler(bufio.NewReader(sr), w)
+	c.src = src
+	c.sr = sr
+	for i, b := range src {
+		if b == '\n' {
+			c.newlines = append(c.newlines, i)
+		}
 	}
 	return c
 }
@@ -45,21 +81,34 @@ func (cr *compiler) Compile() {
 	cr.parseClass()
 }
 
-// CompilePath compiles jack file (without extension) in .vm file; if directory compiles directory
-func CompilePath(path string) {
-	inFile, e := os.Open(path)
+// CompilePath compiles jack file in .vm file next to it; on syntax errors the .vm file
+// is removed and the error has the file name
+func CompilePath(path string, opts Options) (err error) {
+	src, e := ioutil.ReadFile(path)
 	if e != nil {
-		log.Fatal(e)
+		return e
 	}
-	defer inFile.Close()
 	outName := strings.TrimSuffix(path, filepath.Ext(path)) + ".vm"
 	outFile, e := os.Create(outName)
 	if e != nil {
-		log.Fatal(e)
+		return e
 	}
-	defer outFile.Close()
-	cr := newCompiler(bufio.NewReader(inFile), outFile)
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			outFile.Close()
+			os.Remove(outName)
+			err = fmt.Errorf("%s: %s", path, e)
+		}
+	}()
+	cr := newSourceCompiler(src, outFile)
+	cr.file = filepath.Base(path)
+	cr.opts = opts
 	cr.Compile()
+	return outFile.Close()
 }
 
 func (cr compiler) staticN() int {
@@ -151,3 +200,12 @@ func (cr *compiler) nextLabel(name string) string {
 	cr.labelIndex++
 	return label
 }
+
+// lineNo is line of the next unread byte, 0 if source is unknown
+func (cr *compiler) lineNo() int {
+	if cr.sr == nil {
+		return 0
+	}
+	offset := len(cr.src) - cr.sr.Len() - cr.r.Buffered()
+	return sort.SearchInts(cr.newlines, offset) + 1
+}
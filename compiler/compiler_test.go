@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -77,3 +78,37 @@ func FAIL(e error) {
 		panic(e)
 	}
 }
+
+func TestLineNo(t *testing.T) {
+	cr := newSourceCompiler([]byte("class Foo {\n\n  field int x;\n}"), &bytes.Buffer{})
+	if cr.lineNo() != 1 {
+		t.Fatal("wrong first line")
+	}
+	needliteral(cr.r)
+	needliteral(cr.r)
+	needchar(cr.r, '{')
+	peekliteral(cr.r)
+	if cr.lineNo() != 3 {
+		t.Fatalf("line %d, expecting 3", cr.lineNo())
+	}
+}
+
+func TestCompilePathError(t *testing.T) {
+	dir, e := ioutil.TempDir("", "compiler")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Main.jack")
+	ioutil.WriteFile(path, []byte("class Main { function void main() { let = 1; } }"), 0644)
+	e = CompilePath(path, Options{})
+	if e == nil || !strings.HasPrefix(e.Error(), path+": ") {
+		t.Fatalf("got %v", e)
+	}
+	if _, e := os.Stat(filepath.Join(dir, "Main.vm")); !os.IsNotExist(e) {
+		t.Error("partial .vm file kept")
+	}
+	if e := CompilePath(filepath.Join(dir, "Missing.jack"), Options{}); e == nil {
+		t.Error("missing file compiled")
+	}
+}
@@ -8,8 +8,6 @@ read* reads the nearest (no comments)
 import (
 	"bufio"
 	"fmt"
-	"log"
-	"runtime/debug"
 	"strconv"
 )
 
@@ -45,7 +43,7 @@ func isSpace(c byte) bool {
 }
 
 func isLiteral(c byte) bool {
-	return 'A' <= c && c <= 'z'
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || c == '_'
 }
 
 func isInteger(c byte) bool {
@@ -160,12 +158,16 @@ func fail(r *bufio.Reader, args ...interface{}) {
 	if context == "" && e != nil {
 		context = e.Error()
 	}
-	debug.PrintStack()
-	format := args[0].(string)
-	if len(args) == 1 {
-		log.Fatalf("%s at: '%s'\n", format, context)
-	} else {
-		msg := fmt.Sprintf(format, args[1:]...)
-		log.Fatalf("%s at: '%s'\n", msg, context)
+	msg := args[0].(string)
+	if len(args) > 1 {
+		msg = fmt.Sprintf(msg, args[1:]...)
 	}
+	panic(compileError(fmt.Sprintf("%s at: '%s'", msg, context)))
+}
+
+// compileError stops compilation by panic, recovered by CompilePath
+type compileError string
+
+func (e compileError) Error() string {
+	return string(e)
 }
@@ -0,0 +1,170 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"git.andmed.org/nand2tetris/vm"
+	"strings"
+	"testing"
+)
+
+func testOptimized(t *testing.T, exp string, expected string) compiler {
+	buf := bytes.Buffer{}
+	cr := testcompiler(exp, &buf)
+	cr.opts.Optimize = true
+	parsed := cr.parseExpr()
+	cr.code(parsed)
+	if buf.String() != expected {
+		t.Fatalf("error in code generation\nRESULT\n%s\nEXPECTING\n%s\n", buf.String(), expected)
+	}
+	return cr
+}
+
+func TestMultiplyPow2(t *testing.T) {
+	expected := `push local 0
+pop temp 1
+push temp 1
+push temp 1
+add
+pop temp 1
+push temp 1
+push temp 1
+add
+`
+	testOptimized(t, "local*4", expected)
+}
+
+func TestMultiplySmallPure(t *testing.T) {
+	expected := `push local 0
+push local 0
+push local 0
+add
+add
+`
+	testOptimized(t, "3*local", expected)
+}
+
+func TestMultiplySmallExpression(t *testing.T) {
+	expected := `push local 0
+push constant 1
+add
+pop temp 1
+push temp 1
+push temp 1
+push temp 1
+add
+add
+`
+	testOptimized(t, "(local+1)*3", expected)
+}
+
+func TestMultiplyZeroKeepsCall(t *testing.T) {
+	expected := `call Foo.bar 0
+pop temp 0
+push constant 0
+`
+	testOptimized(t, "Foo.bar()*0", expected)
+}
+
+func TestMultiplyLarge(t *testing.T) {
+	expected := `push local 0
+push constant 100
+call Math.multiply 2
+`
+	testOptimized(t, "local*100", expected)
+}
+
+func TestDividePow2(t *testing.T) {
+	cr := testOptimized(t, "local/16", "push local 0\npush constant 16\ncall Test.$divpow2 2\n")
+	if !cr.helpers[helperDivPow2] {
+		t.Fatal("helper not requested")
+	}
+}
+
+func TestDivideOther(t *testing.T) {
+	testOptimized(t, "local/1", "push local 0\n")
+	testOptimized(t, "local/3", "push local 0\npush constant 3\ncall Math.divide 2\n")
+	testOptimized(t, "local/0", "push local 0\npush constant 0\ncall Math.divide 2\n")
+}
+
+func TestHelperEmitted(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("class Foo { function int f(int x) { return x/2; } }", &buf)
+	cr.opts.Optimize = true
+	cr.parseClass()
+	out := buf.String()
+	if !strings.Contains(out, "call Foo.$divpow2 2\n") || !strings.Contains(out, "function Foo.$divpow2 3\n") {
+		t.Fatalf("helper missing\n%s", out)
+	}
+	if strings.Count(out, "function Foo.$divpow2") != 1 {
+		t.Fatal("helper emitted twice")
+	}
+}
+
+// runs 'let r = exp' for x on VM emulator with the Go OS, whose Math.multiply
+// and Math.divide are int16 * and /
+func runExpression(t *testing.T, exp string, x int16, optimize bool) int16 {
+	src := fmt.Sprintf(`class Main {
+  static int r;
+  function void main() {
+    var int x;
+    let x = %d - %d;
+    let r = %s;
+    return;
+  }
+}`, x/2, x/2-x, exp)
+	buf := bytes.Buffer{}
+	cr := newSourceCompiler([]byte(src), &buf)
+	cr.opts.Optimize = optimize
+	cr.Compile()
+
+	m := vm.New()
+	m.UseOS()
+	FAIL(m.Load("Main", &buf))
+	FAIL(m.Start())
+	if _, e := m.Run(1000000); e != nil || m.Status != vm.Halted {
+		t.Fatalf("%s for x=%d: %v", exp, x, e)
+	}
+	return m.RAM[vm.Static]
+}
+
+// TestStrengthReductionSemantics checks optimized code against int16
+// arithmetic: products modulo 2^16, quotients truncated towards zero
+func TestStrengthReductionSemantics(t *testing.T) {
+	values := []int16{0, 1, -1, 2, -2, 3, -3, -4, -5, 7, -15, -16, -17, 100, -100, 255, 1000, -1000,
+		16383, 16384, -16384, -16385, 32766, 32767, -32767, -32768}
+	type spec struct {
+		exp string
+		f   func(x int16) int16
+	}
+	var specs []spec
+	for _, k := range []int16{0, 1, 2, 3, 4, 5, 7, 8, 9, 16, 32, 1024, 16384} {
+		k := k
+		specs = append(specs,
+			spec{fmt.Sprintf("x*%d", k), func(x int16) int16 { return x * k }},
+			spec{fmt.Sprintf("%d*x", k), func(x int16) int16 { return k * x }})
+	}
+	for _, k := range []int16{1, 3} {
+		k := k
+		specs = append(specs, spec{fmt.Sprintf("x/%d", k), func(x int16) int16 { return x / k }})
+	}
+	for k := int16(2); k > 0; k *= 2 {
+		k := k
+		specs = append(specs, spec{fmt.Sprintf("x/%d", k), func(x int16) int16 { return x / k }})
+	}
+	specs = append(specs,
+		spec{"(x+1)*3", func(x int16) int16 { return (x + 1) * 3 }},
+		spec{"(x-(x/4))*8/2", func(x int16) int16 { return (x - x/4) * 8 / 2 }},
+		spec{"-x/2", func(x int16) int16 { return -x / 2 }})
+	for _, s := range specs {
+		for _, x := range values {
+			want := s.f(x)
+			if got := runExpression(t, s.exp, x, false); got != want {
+				t.Fatalf("unoptimized %s for x=%d: %d, want %d", s.exp, x, got, want)
+			}
+			if got := runExpression(t, s.exp, x, true); got != want {
+				t.Errorf("%s for x=%d: %d, want %d", s.exp, x, got, want)
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package compiler
 
-import "log"
+import (
+	"log"
+	"strings"
+)
 
 // TOP LEVEL TOKENS (produce output)
 
@@ -18,6 +21,8 @@ func (cr *compiler) parseClass() {
 		cr.parseFn()
 	}
 	needchar(cr.r, '}')
+	cr.stmtLine = 0
+	cr.emitHelpers()
 }
 
 func (cr *compiler) parseClassVar() {
@@ -36,6 +41,7 @@ func (cr *compiler) parseClassVar() {
 func (cr *compiler) parseFn() {
 	var token fnToken
 	token.mod = needliteral(cr.r)
+	token.line = cr.lineNo()
 	token.rettype = needliteral(cr.r)
 	token.name = needliteral(cr.r)
 	needchar(cr.r, '(')
@@ -73,7 +79,7 @@ func (cr *compiler) parseTerm() interface{} {
 		return term
 	case '"':
 		bytes, _ := cr.r.ReadBytes('"')
-		s := string(bytes[:len(bytes)-2])
+		s := string(bytes[:len(bytes)-1])
 		term := strTerm{s}
 		return term
 	case '-', '~':
@@ -118,6 +124,14 @@ func (cr *compiler) parseLiteralTerm() interface{} {
 			fn:    s,
 			exprs: exprs,
 		}
+	case '[':
+		needchar(cr.r, '[')
+		index := cr.parseExpr()
+		needchar(cr.r, ']')
+		return arrayTerm{
+			name:  s,
+			index: index,
+		}
 	default:
 		return varTerm{s}
 	}
@@ -292,6 +306,11 @@ func (cr *compiler) parseLetStmt() letStmtToken {
 		fail(cr.r, "expecting let stmt")
 	}
 	token.name = needliteral(cr.r)
+	if peekchar(cr.r) == '[' {
+		needchar(cr.r, '[')
+		token.index = cr.parseExpr()
+		needchar(cr.r, ']')
+	}
 	needchar(cr.r, '=')
 	token.exp = cr.parseExpr()
 	needchar(cr.r, ';')
@@ -324,24 +343,69 @@ func (cr *compiler) parseStmts(peek string) []interface{} {
 		return t
 	}
 	for {
+		var stmt interface{}
+		line := cr.lineNo()
 		switch peek {
 		case _let:
-			t = append(t, cr.parseLetStmt())
+			stmt = cr.parseLetStmt()
 		case _if:
-			t = append(t, cr.parseIfStmt())
+			stmt = cr.parseIfStmt()
 		case _while:
-			t = append(t, cr.parseWhileStmt())
+			stmt = cr.parseWhileStmt()
 		case _do:
-			t = append(t, cr.parseDoStmt())
+			stmt = cr.parseDoStmt()
 		case _return:
-			t = append(t, cr.parseReturnStmt())
+			stmt = cr.parseReturnStmt()
+		case _vm, _asm:
+			stmt = cr.parseVMBlock()
 		default:
 			return t
 		}
+		t = append(t, stmtToken{line, stmt})
 		peek = peekliteral(cr.r)
 	}
 }
 
+// block body is read raw up to the closing brace, one VM command per line
+func (cr *compiler) parseVMBlock() vmBlockToken {
+	var token vmBlockToken
+	if cr == nil {
+		return token
+	}
+	if s := needliteral(cr.r); s != _vm && s != _asm {
+		fail(cr.r, "expecting vm block")
+	}
+	needchar(cr.r, '{')
+	// the block ends at the first '}' outside of a comment
+	var line []byte
+	comment := false
+	for {
+		c, e := cr.r.ReadByte()
+		if e != nil {
+			fail(cr.r, "unterminated vm block")
+		}
+		switch {
+		case c == '\n' || c == '}' && !comment:
+			if tokens := strings.Fields(string(line)); len(tokens) > 0 {
+				token.lines = append(token.lines, strings.Join(tokens, " "))
+			}
+			if c == '}' {
+				return token
+			}
+			line, comment = line[:0], false
+		case comment:
+		case c == '/':
+			if next, _ := cr.r.Peek(1); len(next) == 1 && next[0] == '/' {
+				comment = true
+			} else {
+				line = append(line, c)
+			}
+		default:
+			line = append(line, c)
+		}
+	}
+}
+
 func (cr *compiler) parseFnVar() varDeclToken {
 	var token varDeclToken
 	if cr == nil {
@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -279,3 +280,70 @@ call Memory.poke 2
 		t.Fail()
 	}
 }
+
+func TestVMBlock(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler(`vm {
+		push local   // jack var
+		push  arg
+		add // sum
+		pop static 0
+	}`, &buf)
+	expected := "push local 0\npush argument 0\nadd\npop static 0\n"
+	stmts := cr.parseStmts(peekliteral(cr.r))
+	if len(stmts) != 1 {
+		t.Fatalf("parsed %d statements", len(stmts))
+	}
+	cr.code(stmts[0])
+	if buf.String() != expected {
+		println(buf.String())
+		t.Fail()
+	}
+}
+
+func TestAsmBlockField(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("asm { push field\npop temp 2 }", &buf)
+	expected := "push this 0\npop temp 2\n"
+	cr.code(cr.parseVMBlock())
+	if buf.String() != expected {
+		println(buf.String())
+		t.Fail()
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	expected := `push constant 3
+call String.new 1
+push constant 72
+call String.appendChar 2
+push constant 105
+call String.appendChar 2
+push constant 33
+call String.appendChar 2
+`
+	testExpString(t, `"Hi!"`, expected)
+}
+
+func TestVMBlockCommentBrace(t *testing.T) {
+	buf := bytes.Buffer{}
+	cr := testcompiler("vm {\n\tpush local // } not the end\n\tpop static 0 }\nlet local = 1;", &buf)
+	cr.code(cr.parseVMBlock())
+	if buf.String() != "push local 0\npop static 0\n" {
+		t.Fatalf("got\n%s", buf.String())
+	}
+	if s := peekliteral(cr.r); s != "let" {
+		t.Fatalf("block ended before %q", s)
+	}
+}
+
+func TestVMBlockFieldInFunction(t *testing.T) {
+	cr := testcompiler("vm { push field }", &bytes.Buffer{})
+	cr.fnMod = _function
+	defer func() {
+		if e, ok := recover().(compileError); !ok || !strings.Contains(e.Error(), "field field in function") {
+			t.Fatalf("got %v", e)
+		}
+	}()
+	cr.code(cr.parseVMBlock())
+}
@@ -0,0 +1,125 @@
+package compiler
+
+import "sort"
+
+// runtime helpers, compiled into each class that needs them
+const (
+	helperIndex    = "$aidx"
+	helperNew      = "$anew"
+	helperDispose  = "$adispose"
+	helperNonZero  = "$nz"
+	arrayHeaderLen = 1 // hidden word before elements holding array length
+)
+
+// arrayHelper replaces Array.new and Array.dispose with versions keeping the length header
+func (cr *compiler) arrayHelper(fn string) (string, string) {
+	switch fn {
+	case "new":
+		fn = helperNew
+	case "dispose":
+		fn = helperDispose
+	default:
+		return "Array", fn
+	}
+	cr.helpers[fn] = true
+	return cr.class, fn
+}
+
+// emitHelpers appends runtime helpers used by the class code
+func (cr *compiler) emitHelpers() {
+	var names []string
+	for name := range cr.helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case helperDivPow2:
+			cr.divPow2()
+		case helperIndex:
+			cr.arrayIndex()
+		case helperNew:
+			cr.arrayNew()
+		case helperDispose:
+			cr.arrayDispose()
+		case helperNonZero:
+			cr.nonZeroHelper()
+		}
+	}
+}
+
+// arrayIndex returns address of element argument 1 of array argument 0,
+// calls Sys.error with code argument 2 if array is null or index is out of range;
+// null is 0, so direct memory access through an Array at 0 fails too
+func (cr *compiler) arrayIndex() {
+	bad := cr.nextLabel("aidx_fail")
+	ok := cr.nextLabel("aidx_ok")
+
+	cr.linef("function %s.%s 0", cr.class, helperIndex)
+	cr.pushArg(0)
+	cr.pushConst(0)
+	cr.line("eq")
+	cr.line("if-goto " + bad)
+	cr.pushArg(1)
+	cr.pushConst(0)
+	cr.line("lt")
+	cr.line("if-goto " + bad)
+	cr.pushArg(0)
+	cr.pushConst(arrayHeaderLen)
+	cr.line("sub")
+	cr.line("pop pointer 1")
+	cr.pushArg(1)
+	cr.pushThat(0)
+	cr.line("lt")
+	cr.line("if-goto " + ok)
+	cr.line("label " + bad)
+	cr.pushArg(2)
+	cr.line("call Sys.error 1")
+	cr.popTemp(0)
+	cr.line("label " + ok)
+	cr.pushArg(0)
+	cr.pushArg(1)
+	cr.line("add")
+	cr.line("return")
+}
+
+// arrayNew allocates array of argument 0 elements after the length header
+func (cr *compiler) arrayNew() {
+	cr.linef("function %s.%s 0", cr.class, helperNew)
+	cr.pushArg(0)
+	cr.pushConst(arrayHeaderLen)
+	cr.line("add")
+	cr.line("call Memory.alloc 1")
+	cr.line("pop pointer 1")
+	cr.pushArg(0)
+	cr.popThat(0)
+	cr.pushPointer(1)
+	cr.pushConst(arrayHeaderLen)
+	cr.line("add")
+	cr.line("return")
+}
+
+// arrayDispose frees array allocated with arrayNew
+func (cr *compiler) arrayDispose() {
+	cr.linef("function %s.%s 0", cr.class, helperDispose)
+	cr.pushArg(0)
+	cr.pushConst(arrayHeaderLen)
+	cr.line("sub")
+	cr.line("call Memory.deAlloc 1")
+	cr.line("return")
+}
+
+// nonZeroHelper returns argument 0, calls Sys.error with code argument 1 if it is zero
+func (cr *compiler) nonZeroHelper() {
+	ok := cr.nextLabel("nz_ok")
+
+	cr.linef("function %s.%s 0", cr.class, helperNonZero)
+	cr.pushArg(0)
+	cr.line("if-goto " + ok)
+	cr.pushArg(1)
+	cr.line("call Sys.error 1")
+	cr.popTemp(0)
+	cr.line("label " + ok)
+	cr.pushArg(0)
+	cr.line("return")
+}
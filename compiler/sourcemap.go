@@ -0,0 +1,92 @@
+package compiler
+
+// SourceMap collects positions of compiled code in Jack sources and Jack symbols,
+// debuggers use it to show VM code as Jack
+type SourceMap struct {
+	Lines     map[string][]int     // class -> Jack line of every VM line, 0 for generated code
+	Files     map[string]string    // class -> Jack file name
+	Functions map[string]*Function // by full name, Class.name
+	Classes   map[string]*Class
+}
+
+// Var is a Jack variable and its place in VM memory segment
+type Var struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Segment string `json:"segment"` // local, argument, this or static
+	Index   int    `json:"index"`
+}
+
+// Function is a Jack subroutine with its arguments and locals,
+// methods have this as argument 0, constructors as local 0
+type Function struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // constructor, function or method
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Args   []Var  `json:"args"`
+	Locals []Var  `json:"locals"`
+}
+
+// Class has fields and static variables
+type Class struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Fields  []Var  `json:"fields"`
+	Statics []Var  `json:"statics"`
+}
+
+// NewSourceMap returns empty source map
+func NewSourceMap() *SourceMap {
+	return &SourceMap{
+		Lines:     map[string][]int{},
+		Files:     map[string]string{},
+		Functions: map[string]*Function{},
+		Classes:   map[string]*Class{},
+	}
+}
+
+// VM segments of variable kinds
+var segments = map[int]string{
+	regStatic: "static",
+	regField:  "this",
+	regArg:    "argument",
+	regLocal:  "local",
+}
+
+// mapLines records current statement line for n VM lines just written
+func (cr compiler) mapLines(n int) {
+	m := cr.opts.Source
+	if m == nil {
+		return
+	}
+	for ; n > 0; n-- {
+		m.Lines[cr.class] = append(m.Lines[cr.class], cr.stmtLine)
+	}
+	m.Files[cr.class] = cr.file
+}
+
+// mapFunction records symbols of current subroutine and its class
+func (cr *compiler) mapFunction() {
+	m := cr.opts.Source
+	if m == nil {
+		return
+	}
+	fn := &Function{Name: cr.class + "." + cr.fn, Kind: cr.fnMod, File: cr.file, Line: cr.stmtLine}
+	class := &Class{Name: cr.class, File: cr.file}
+	for _, v := range cr.vars {
+		mv := Var{Name: v.name, Type: v.typ, Segment: segments[v.reg], Index: v.idx}
+		switch v.reg {
+		case regStatic:
+			class.Statics = append(class.Statics, mv)
+		case regField:
+			class.Fields = append(class.Fields, mv)
+		case regArg:
+			fn.Args = append(fn.Args, mv)
+		case regLocal:
+			fn.Locals = append(fn.Locals, mv)
+		}
+	}
+	m.Functions[fn.Name] = fn
+	m.Classes[cr.class] = class
+}
@@ -13,6 +13,7 @@ type varDeclToken struct {
 
 // ('constructor' | 'function' | 'method') ('void' | type) subroutineName '(' parameterList ')' subroutineBody
 type fnToken struct {
+	line    int
 	mod     string
 	rettype string
 	name    string
@@ -34,8 +35,9 @@ type fnBodyToken struct {
 
 // 'let' varName ('[' expression ']')? '=' expression ';'
 type letStmtToken struct {
-	name string
-	exp  expression
+	name  string
+	index expression // array element if set
+	exp   expression
 }
 
 // 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
@@ -61,6 +63,17 @@ type returnStmtToken struct {
 	exp expression
 }
 
+// statement with its source line
+type stmtToken struct {
+	line int
+	stmt interface{} // stmt
+}
+
+// ('vm' | 'asm') '{' vmCommand* '}'
+type vmBlockToken struct {
+	lines []string
+}
+
 // TERMS
 
 type expression struct {
@@ -97,6 +110,12 @@ type varTerm struct {
 	string
 }
 
+// varName '[' expression ']'
+type arrayTerm struct {
+	name  string
+	index expression
+}
+
 type unaryOpTerm struct {
 	byte             // operation - ~
 	term interface{} // term
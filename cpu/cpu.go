@@ -0,0 +1,153 @@
+// Package cpu emulates the HACK computer (hdl/Computer.hdl): CPU, 32K ROM and 32K RAM
+// with the screen memory map and the keyboard register
+package cpu
+
+import (
+	"git.andmed.org/nand2tetris/assembler"
+	"io"
+)
+
+// memory map
+const (
+	ROMSize    = 1 << 15
+	RAMSize    = 1 << 15
+	Screen     = 16384 // 512x256 pixels, 32 words per row
+	ScreenSize = 8192
+	Keyboard   = 24576 // code of pressed key
+)
+
+// Computer is HACK CPU with memory
+type Computer struct {
+	ROM    [ROMSize]uint16
+	RAM    [RAMSize]int16
+	A      int16
+	D      int16
+	PC     uint16
+	Cycles uint64 // instructions executed since reset
+}
+
+// Load puts program to ROM and resets the computer
+func (c *Computer) Load(code []uint16) {
+	c.ROM = [ROMSize]uint16{}
+	copy(c.ROM[:], code)
+	c.Reset()
+}
+
+// LoadHack loads text or raw machine code
+func (c *Computer) LoadHack(r io.Reader) error {
+	code, e := assembler.ReadHack(r)
+	if e != nil {
+		return e
+	}
+	c.Load(code)
+	return nil
+}
+
+// LoadAsm assembles program and loads it, returning its symbols
+func (c *Computer) LoadAsm(r io.Reader) (assembler.Symbols, error) {
+	var a assembler.Assembler
+	if e := a.Parse(r); e != nil {
+		return assembler.Symbols{}, e
+	}
+	c.Load(a.Code)
+	return a.Symbols(), nil
+}
+
+// Reset starts program over, memory is kept as with reset pin of the computer
+func (c *Computer) Reset() {
+	c.PC = 0
+	c.Cycles = 0
+}
+
+// SetKey puts key code to the keyboard register, 0 for no key
+func (c *Computer) SetKey(key int16) {
+	c.RAM[Keyboard] = key
+}
+
+// Step executes one instruction
+func (c *Computer) Step() {
+	instr := c.ROM[c.PC&(ROMSize-1)]
+	c.Cycles++
+	if instr&0x8000 == 0 {
+		c.A = int16(instr)
+		c.PC++
+		return
+	}
+
+	address := uint16(c.A) & (RAMSize - 1)
+	y := c.A
+	if instr&0x1000 != 0 {
+		y = c.RAM[address]
+	}
+	out := ALU(c.D, y, instr>>6)
+
+	// registers commit after the instruction, so M and jump use the old A
+	jumpTo := uint16(c.A)
+	if instr&0x08 != 0 && address != Keyboard {
+		c.RAM[address] = out
+	}
+	if instr&0x10 != 0 {
+		c.D = out
+	}
+	if instr&0x20 != 0 {
+		c.A = out
+	}
+	if jumps(instr, out) {
+		c.PC = jumpTo & (ROMSize - 1)
+	} else {
+		c.PC++
+	}
+}
+
+// Run executes up to max instructions, stopping early if program halts,
+// returns number of instructions executed
+func (c *Computer) Run(max uint64) uint64 {
+	var n uint64
+	for ; n < max && !c.Halted(); n++ {
+		c.Step()
+	}
+	return n
+}
+
+// Halted is true if PC is at an endless '@X / 0;JMP' loop at address X
+func (c *Computer) Halted() bool {
+	pc := c.PC & (ROMSize - 1)
+	return c.ROM[pc] == pc && pc+1 < ROMSize && c.ROM[pc+1]&0xe007 == 0xe007
+}
+
+// ALU computes HACK ALU function zx nx zy ny f no (lower 6 bits of control)
+func ALU(x, y int16, control uint16) int16 {
+	if control&0x20 != 0 {
+		x = 0
+	}
+	if control&0x10 != 0 {
+		x = ^x
+	}
+	if control&0x08 != 0 {
+		y = 0
+	}
+	if control&0x04 != 0 {
+		y = ^y
+	}
+	var out int16
+	if control&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
+
+func jumps(instr uint16, out int16) bool {
+	switch {
+	case out < 0:
+		return instr&4 != 0
+	case out == 0:
+		return instr&2 != 0
+	default:
+		return instr&1 != 0
+	}
+}
@@ -0,0 +1,133 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, asm string) *Computer {
+	var c Computer
+	if _, e := c.LoadAsm(strings.NewReader(asm)); e != nil {
+		t.Fatal(e)
+	}
+	return &c
+}
+
+// projects/04 Mult: R2 = R0 * R1
+const mult = `
+@R2
+M=0
+(LOOP)
+@R0
+D=M
+@END
+D;JLE
+@R1
+D=M
+@R2
+M=D+M
+@R0
+M=M-1
+@LOOP
+0;JMP
+(END)
+@END
+0;JMP
+`
+
+func TestMult(t *testing.T) {
+	for _, tc := range [][3]int16{{0, 0, 0}, {1, 0, 0}, {3, 1, 3}, {2, 4, 8}, {6, 7, 42}, {100, -3, -300}} {
+		c := load(t, mult)
+		c.RAM[0], c.RAM[1] = tc[0], tc[1]
+		c.Run(10000)
+		if !c.Halted() {
+			t.Fatal("not halted")
+		}
+		if c.RAM[2] != tc[2] {
+			t.Fatalf("%d*%d = %d", tc[0], tc[1], c.RAM[2])
+		}
+	}
+}
+
+func TestOldA(t *testing.T) {
+	c := load(t, `
+@100
+M=1
+AM=M+1
+@6
+A=A+1;JMP
+@200
+@300
+`)
+	c.Run(5)
+	if c.RAM[100] != 2 || c.A != 7 || c.PC != 6 {
+		t.Fatalf("RAM[100]=%d A=%d PC=%d", c.RAM[100], c.A, c.PC)
+	}
+	c.Step()
+	if c.A != 300 {
+		t.Fatal("jump did not use A before instruction")
+	}
+}
+
+func TestScreenKeyboard(t *testing.T) {
+	c := load(t, `
+@KBD
+D=M
+@SCREEN
+M=D
+@KBD
+M=-1
+`)
+	c.SetKey(65)
+	c.Run(6)
+	if c.RAM[Screen] != 65 {
+		t.Fatal("keyboard not read")
+	}
+	if c.RAM[Keyboard] != 65 {
+		t.Fatal("keyboard is read only")
+	}
+	if c.Cycles != 6 {
+		t.Fatalf("%d cycles", c.Cycles)
+	}
+}
+
+func TestALU(t *testing.T) {
+	// control bits from the book table
+	for _, tc := range []struct {
+		control uint16
+		x, y    int16
+		out     int16
+	}{
+		{0x2a, 5, 7, 0},
+		{0x3f, 5, 7, 1},
+		{0x3a, 5, 7, -1},
+		{0x0c, 5, 7, 5},
+		{0x30, 5, 7, 7},
+		{0x0d, 5, 7, ^5},
+		{0x0f, 5, 7, -5},
+		{0x33, 5, 7, -7},
+		{0x1f, 5, 7, 6},
+		{0x32, 5, 7, 6},
+		{0x02, 5, 7, 12},
+		{0x13, 5, 7, -2},
+		{0x07, 5, 7, 2},
+		{0x00, 5, 7, 5},
+		{0x15, 5, 7, 7},
+		{0x02, 32767, 1, -32768},
+	} {
+		if out := ALU(tc.x, tc.y, tc.control); out != tc.out {
+			t.Errorf("control %02x: %d, want %d", tc.control, out, tc.out)
+		}
+	}
+}
+
+func TestLoadHack(t *testing.T) {
+	var c Computer
+	if e := c.LoadHack(strings.NewReader("0000000000000111\n1110110000010000\n")); e != nil {
+		t.Fatal(e)
+	}
+	c.Run(2)
+	if c.D != 7 {
+		t.Fatalf("D=%d", c.D)
+	}
+}
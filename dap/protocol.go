@@ -0,0 +1,128 @@
+// Package dap serves the Debug Adapter Protocol for programs run on the VM and CPU emulators:
+// Jack and VM programs on the VM emulator, assembly on the CPU emulator
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Request is a message from the client
+type Request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Response answers a request
+type Response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// Event is a message sent by the server on its own
+type Event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// ReadMessage reads one message framed by Content-Length header
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		s, e := r.ReadString('\n')
+		if e != nil {
+			return nil, e
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+		i := strings.Index(s, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("bad header '%s'", s)
+		}
+		if strings.EqualFold(strings.TrimSpace(s[:i]), "Content-Length") {
+			if length, e = strconv.Atoi(strings.TrimSpace(s[i+1:])); e != nil || length < 0 {
+				return nil, fmt.Errorf("bad header '%s'", s)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("no Content-Length header")
+	}
+	data := make([]byte, length)
+	_, e := io.ReadFull(r, data)
+	return data, e
+}
+
+// WriteMessage writes message as JSON framed by Content-Length header
+func WriteMessage(w io.Writer, msg interface{}) error {
+	data, e := json.Marshal(msg)
+	if e != nil {
+		return e
+	}
+	if _, e := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); e != nil {
+		return e
+	}
+	_, e = w.Write(data)
+	return e
+}
+
+// protocol types used in bodies
+
+// Source is a source file
+type Source struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Breakpoint is a breakpoint as set
+type Breakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Source   Source `json:"source"`
+	Message  string `json:"message,omitempty"`
+}
+
+// StackFrame is a function call
+type StackFrame struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *Source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+}
+
+// Scope is a group of variables of a frame
+type Scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+// Variable is a named value
+type Variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// Thread is a thread of the program, there is only one
+type Thread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
@@ -0,0 +1,367 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// steps run between checks for requests
+const chunk = 10000
+
+// variable references of a frame, one per scope
+const scopeRefs = 8
+
+// the only thread
+const threadID = 1
+
+type mode int
+
+// execution modes
+const (
+	stopped mode = iota
+	running
+	stepOver
+	stepIn
+	stepOut
+)
+
+// Server answers requests of one client and runs its program
+type Server struct {
+	r      *bufio.Reader
+	w      io.Writer
+	seq    int
+	t      target
+	breaks map[location]bool
+	mode   mode
+	from   int  // call depth where stepping started
+	entry  bool // stop on entry
+	ended  bool
+}
+
+// NewServer returns server reading requests from r and writing responses and events to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{r: bufio.NewReader(r), w: w, breaks: map[location]bool{}}
+}
+
+// incoming is a request read by Serve, err is set if it is malformed
+type incoming struct {
+	req Request
+	err error
+}
+
+// Serve handles requests until disconnect or end of input; the program runs
+// between requests. Malformed requests get an error response
+func (s *Server) Serve() error {
+	requests := make(chan incoming)
+	errs := make(chan error, 1)
+	quit := make(chan struct{}) // stops reader after Serve returns
+	defer close(quit)
+	go func() {
+		defer close(requests)
+		for {
+			data, e := ReadMessage(s.r)
+			if e != nil {
+				errs <- e
+				return
+			}
+			var in incoming
+			if e := json.Unmarshal(data, &in.req); e != nil {
+				in.err = fmt.Errorf("malformed request: %s", e)
+			}
+			select {
+			case requests <- in:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	for {
+		var in incoming
+		var ok bool
+		if s.mode == stopped {
+			in, ok = <-requests
+		} else {
+			select {
+			case in, ok = <-requests:
+			default:
+				if e := s.run(chunk); e != nil {
+					return e
+				}
+				continue
+			}
+		}
+		if !ok {
+			if e := <-errs; e != io.EOF {
+				return e
+			}
+			return nil
+		}
+		if in.err != nil {
+			if e := s.respond(in.req, nil, in.err); e != nil {
+				return e
+			}
+			continue
+		}
+		done, e := s.handle(in.req)
+		if done || e != nil {
+			return e
+		}
+	}
+}
+
+// handle answers request, done after disconnect
+func (s *Server) handle(req Request) (done bool, err error) {
+	var body interface{}
+	var e error
+	switch req.Command {
+	case "initialize":
+		body = map[string]interface{}{"supportsConfigurationDoneRequest": true}
+	case "launch":
+		e = s.launch(req.Arguments)
+	case "disconnect":
+		return true, s.respond(req, nil, nil)
+	default:
+		if s.t == nil {
+			e = fmt.Errorf("%s: no program launched", req.Command)
+			break
+		}
+		body, e = s.control(req)
+	}
+	if err := s.respond(req, body, e); err != nil || e != nil {
+		return false, err
+	}
+	switch req.Command {
+	case "launch":
+		return false, s.event("initialized", nil)
+	case "configurationDone":
+		if s.entry {
+			return false, s.stop("entry")
+		}
+		s.resume(running)
+	case "pause":
+		if s.mode != stopped {
+			return false, s.stop("pause")
+		}
+	}
+	return false, nil
+}
+
+func (s *Server) launch(args json.RawMessage) error {
+	var launch struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if e := json.Unmarshal(args, &launch); e != nil {
+		return e
+	}
+	if launch.Program == "" {
+		return fmt.Errorf("launch: no program")
+	}
+	t, e := load(launch.Program)
+	if e != nil {
+		return e
+	}
+	s.t, s.entry = t, launch.StopOnEntry
+	return nil
+}
+
+// control answers requests about the launched program
+func (s *Server) control(req Request) (interface{}, error) {
+	switch req.Command {
+	case "setBreakpoints":
+		var args struct {
+			Source      Source `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if e := json.Unmarshal(req.Arguments, &args); e != nil {
+			return nil, e
+		}
+		var lines []int
+		for _, b := range args.Breakpoints {
+			lines = append(lines, b.Line)
+		}
+		return map[string]interface{}{"breakpoints": s.setBreakpoints(args.Source, lines)}, nil
+	case "setExceptionBreakpoints", "configurationDone":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		var stack []StackFrame
+		for i, f := range s.t.frames() {
+			sf := StackFrame{ID: i + 1, Name: f.name, Line: f.loc.line, Column: 1}
+			if f.loc.path != "" {
+				sf.Source = &Source{Name: filepath.Base(f.loc.path), Path: f.loc.path}
+			}
+			stack = append(stack, sf)
+		}
+		return map[string]interface{}{"stackFrames": stack, "totalFrames": len(stack)}, nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if e := json.Unmarshal(req.Arguments, &args); e != nil {
+			return nil, e
+		}
+		f, e := s.frame(args.FrameID)
+		if e != nil {
+			return nil, e
+		}
+		scopes := []Scope{}
+		for i, sc := range f.scopes {
+			scopes = append(scopes, Scope{Name: sc.name, VariablesReference: args.FrameID*scopeRefs + i})
+		}
+		return map[string]interface{}{"scopes": scopes}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if e := json.Unmarshal(req.Arguments, &args); e != nil {
+			return nil, e
+		}
+		f, e := s.frame(args.VariablesReference / scopeRefs)
+		if e != nil {
+			return nil, e
+		}
+		i := args.VariablesReference % scopeRefs
+		if i >= len(f.scopes) {
+			return nil, fmt.Errorf("no variables %d", args.VariablesReference)
+		}
+		return map[string]interface{}{"variables": f.scopes[i].vars}, nil
+	case "continue":
+		s.resume(running)
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next":
+		s.resume(stepOver)
+	case "stepIn":
+		s.resume(stepIn)
+	case "stepOut":
+		s.resume(stepOut)
+	case "pause":
+	default:
+		return nil, fmt.Errorf("%s: not supported", req.Command)
+	}
+	return nil, nil
+}
+
+// frame returns frame by id, 1 is the innermost
+func (s *Server) frame(id int) (frame, error) {
+	frames := s.t.frames()
+	if id < 1 || id > len(frames) {
+		return frame{}, fmt.Errorf("no frame %d", id)
+	}
+	return frames[id-1], nil
+}
+
+// setBreakpoints replaces breakpoints of source, a line without code moves to the next line with code
+func (s *Server) setBreakpoints(src Source, lines []int) []Breakpoint {
+	path, _ := filepath.Abs(src.Path)
+	for loc := range s.breaks {
+		if loc.path == path {
+			delete(s.breaks, loc)
+		}
+	}
+	code := s.t.lines()[path]
+	breakpoints := []Breakpoint{}
+	for _, line := range lines {
+		b := Breakpoint{Source: src, Line: line}
+		if i := sort.SearchInts(code, line); i < len(code) {
+			b.Verified, b.Line = true, code[i]
+			s.breaks[location{path, code[i]}] = true
+		} else {
+			b.Message = "no code"
+		}
+		breakpoints = append(breakpoints, b)
+	}
+	return breakpoints
+}
+
+// resume runs program in mode
+func (s *Server) resume(m mode) {
+	if s.ended {
+		s.mode = running // run reports the end again
+		return
+	}
+	s.mode, s.from = m, s.t.depth()
+}
+
+// run executes up to n steps until breakpoint, end of stepping or end of program
+func (s *Server) run(n int) error {
+	for i := 0; i < n; i++ {
+		if s.ended {
+			return s.end(0)
+		}
+		if e := s.t.step(); e != nil {
+			if err := s.output(e.Error()+"\n", "stderr"); err != nil {
+				return err
+			}
+			return s.end(1)
+		}
+		if ended, code := s.t.ended(); ended {
+			return s.end(code)
+		}
+		if s.mode == stepOut && s.t.depth() < s.from {
+			return s.stop("step")
+		}
+		if !s.t.statement() {
+			continue
+		}
+		switch {
+		case s.breaks[s.t.position()]:
+			return s.stop("breakpoint")
+		case s.mode == stepIn, s.mode == stepOver && s.t.depth() <= s.from:
+			return s.stop("step")
+		}
+	}
+	s.flush()
+	return nil
+}
+
+func (s *Server) stop(reason string) error {
+	s.mode = stopped
+	s.flush()
+	return s.event("stopped", map[string]interface{}{
+		"reason": reason, "threadId": threadID, "allThreadsStopped": true,
+	})
+}
+
+// end reports end of program with exit code
+func (s *Server) end(code int) error {
+	s.ended = true
+	s.mode = stopped
+	s.flush()
+	if e := s.event("exited", map[string]interface{}{"exitCode": code}); e != nil {
+		return e
+	}
+	return s.event("terminated", nil)
+}
+
+// flush sends text printed by the program
+func (s *Server) flush() {
+	if text := s.t.output(); text != "" {
+		s.output(text, "stdout")
+	}
+}
+
+func (s *Server) output(text, category string) error {
+	return s.event("output", map[string]interface{}{"category": category, "output": text})
+}
+
+func (s *Server) respond(req Request, body interface{}, e error) error {
+	s.seq++
+	resp := Response{Seq: s.seq, Type: "response", RequestSeq: req.Seq, Success: e == nil, Command: req.Command, Body: body}
+	if e != nil {
+		resp.Message = e.Error()
+	}
+	return WriteMessage(s.w, resp)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	s.seq++
+	return WriteMessage(s.w, Event{Seq: s.seq, Type: "event", Event: name, Body: body})
+}
@@ -0,0 +1,257 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+// message is a response or event as the client reads it
+type message struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// start runs server connected to a client
+func start(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+	return &client{t: t, w: inW, r: bufio.NewReader(outR)}, done
+}
+
+func (c *client) send(command string, args interface{}) {
+	c.seq++
+	data, _ := json.Marshal(args)
+	req := Request{Seq: c.seq, Type: "request", Command: command, Arguments: data}
+	if e := WriteMessage(c.w, req); e != nil {
+		c.t.Fatal(e)
+	}
+}
+
+// expect reads messages until response to command or event, decoding its body into v
+func (c *client) expect(name string, v interface{}) {
+	c.t.Helper()
+	for {
+		data, e := ReadMessage(c.r)
+		if e != nil {
+			c.t.Fatalf("waiting for %s: %s", name, e)
+		}
+		var msg message
+		if e := json.Unmarshal(data, &msg); e != nil {
+			c.t.Fatal(e)
+		}
+		if msg.Command != name && msg.Event != name {
+			continue
+		}
+		if msg.Type == "response" && !msg.Success {
+			c.t.Fatalf("%s: %s", name, msg.Message)
+		}
+		if v != nil {
+			if e := json.Unmarshal(msg.Body, v); e != nil {
+				c.t.Fatal(e)
+			}
+		}
+		return
+	}
+}
+
+// call sends request and reads its response
+func (c *client) call(command string, args, v interface{}) {
+	c.t.Helper()
+	c.send(command, args)
+	c.expect(command, v)
+}
+
+func (c *client) launch(program string, breakFile string, line int) []Breakpoint {
+	c.t.Helper()
+	c.call("initialize", map[string]string{"adapterID": "hack"}, nil)
+	c.call("launch", map[string]string{"program": program}, nil)
+	c.expect("initialized", nil)
+	var bps struct{ Breakpoints []Breakpoint }
+	c.call("setBreakpoints", map[string]interface{}{
+		"source":      Source{Path: breakFile},
+		"breakpoints": []map[string]int{{"line": line}},
+	}, &bps)
+	c.call("configurationDone", nil, nil)
+	return bps.Breakpoints
+}
+
+func (c *client) stack() []StackFrame {
+	c.t.Helper()
+	var st struct{ StackFrames []StackFrame }
+	c.call("stackTrace", map[string]int{"threadId": threadID}, &st)
+	return st.StackFrames
+}
+
+func (c *client) variables(frame int, scope string) []Variable {
+	c.t.Helper()
+	var scopes struct{ Scopes []Scope }
+	c.call("scopes", map[string]int{"frameId": frame}, &scopes)
+	for _, s := range scopes.Scopes {
+		if s.Name == scope {
+			var vars struct{ Variables []Variable }
+			c.call("variables", map[string]int{"variablesReference": s.VariablesReference}, &vars)
+			return vars.Variables
+		}
+	}
+	c.t.Fatalf("no scope %s in %+v", scope, scopes)
+	return nil
+}
+
+func TestVM(t *testing.T) {
+	c, done := start(t)
+	dir, _ := filepath.Abs("../testdata/FunctionCalls/FibonacciElement")
+	main := filepath.Join(dir, "Main.vm")
+	if bps := c.launch(dir, main, 13); len(bps) != 1 || !bps[0].Verified || bps[0].Line != 13 {
+		t.Fatalf("%+v", bps)
+	}
+	var stop struct{ Reason string }
+	c.expect("stopped", &stop)
+	stack := c.stack()
+	if stop.Reason != "breakpoint" || len(stack) != 4 || stack[0].Name != "Main.fibonacci" || stack[0].Line != 13 ||
+		stack[0].Source.Path != main || stack[1].Line != 19 || stack[3].Name != "Sys.init" || stack[3].Line != 8 {
+		t.Fatalf("%s at %+v", stop.Reason, stack)
+	}
+	if args := c.variables(1, "argument"); len(args) != 1 || args[0].Value != "0" {
+		t.Errorf("arguments %+v", args)
+	}
+	if args := c.variables(2, "argument"); len(args) != 1 || args[0].Value != "2" {
+		t.Errorf("caller arguments %+v", args)
+	}
+	if temp := c.variables(1, "temp"); len(temp) != 8 {
+		t.Errorf("temp %+v", temp)
+	}
+
+	c.call("stepOut", map[string]int{"threadId": threadID}, nil)
+	c.expect("stopped", &stop)
+	if stack := c.stack(); stop.Reason != "step" || len(stack) != 3 || stack[0].Line != 20 {
+		t.Fatalf("%s at %+v", stop.Reason, stack)
+	}
+
+	c.call("setBreakpoints", map[string]interface{}{"source": Source{Path: main}, "breakpoints": []int{}}, nil)
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	var exited struct{ ExitCode int }
+	c.expect("exited", &exited)
+	c.expect("terminated", nil)
+	c.call("disconnect", nil, nil)
+	if e := <-done; e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestJack(t *testing.T) {
+	c, done := start(t)
+	dir, _ := filepath.Abs("../debuginfo/testdata/Twice")
+	main := filepath.Join(dir, "Main.jack")
+	// declaration without code moves to the next statement
+	if bps := c.launch(dir, main, 16); len(bps) != 1 || !bps[0].Verified || bps[0].Line != 17 {
+		t.Fatalf("%+v", bps)
+	}
+	c.expect("stopped", nil)
+	if stack := c.stack(); len(stack) != 3 || stack[0].Name != "Main.twice" || stack[0].Line != 17 ||
+		stack[1].Name != "Main.main" || stack[1].Line != 9 || stack[2].Source.Name != "Sys.jack" {
+		t.Fatalf("%+v", stack)
+	}
+	if args := c.variables(1, "argument"); len(args) != 1 || args[0] != (Variable{Name: "n", Value: "3", Type: "int"}) {
+		t.Errorf("arguments %+v", args)
+	}
+	if locals := c.variables(2, "local"); len(locals) != 3 || locals[0].Name != "a" || locals[0].Value != "3" ||
+		locals[2].Type != "char" {
+		t.Errorf("caller locals %+v", locals)
+	}
+	if statics := c.variables(1, "static"); len(statics) != 1 || statics[0].Name != "count" {
+		t.Errorf("statics %+v", statics)
+	}
+
+	c.call("next", map[string]int{"threadId": threadID}, nil)
+	c.expect("stopped", nil)
+	if stack := c.stack(); stack[0].Line != 18 {
+		t.Fatalf("next at %+v", stack[0])
+	}
+	c.call("stepIn", map[string]int{"threadId": threadID}, nil)
+	c.expect("stopped", nil)
+	if stack := c.stack(); len(stack) != 2 || stack[0].Line != 10 {
+		t.Fatalf("step in at %+v", stack)
+	}
+	c.call("disconnect", nil, nil)
+	if e := <-done; e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestAsm(t *testing.T) {
+	c, done := start(t)
+	program, _ := filepath.Abs("testdata/Sum.asm")
+	// label line moves to the next instruction
+	if bps := c.launch(program, program, 6); len(bps) != 1 || bps[0].Line != 7 {
+		t.Fatalf("%+v", bps)
+	}
+	c.expect("stopped", nil)
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	c.expect("stopped", nil)
+	if stack := c.stack(); len(stack) != 1 || stack[0].Name != "main" || stack[0].Line != 7 {
+		t.Fatalf("%+v", stack)
+	}
+	if vars := c.variables(1, "static"); len(vars) != 2 || vars[0] != (Variable{Name: "i", Value: "2"}) ||
+		vars[1] != (Variable{Name: "sum", Value: "1"}) {
+		t.Errorf("variables %+v", vars)
+	}
+	c.call("setBreakpoints", map[string]interface{}{"source": Source{Path: program}, "breakpoints": []int{}}, nil)
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	c.expect("terminated", nil)
+	c.call("disconnect", nil, nil)
+	if e := <-done; e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	before := runtime.NumGoroutine()
+	c, done := start(t)
+	fmt.Fprintf(c.w, "Content-Length: 5\r\n\r\n{bad}")
+	data, e := ReadMessage(c.r)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var msg message
+	if e := json.Unmarshal(data, &msg); e != nil || msg.Type != "response" || msg.Success ||
+		!strings.HasPrefix(msg.Message, "malformed request") {
+		t.Fatalf("%s", data)
+	}
+	c.call("initialize", map[string]string{"adapterID": "hack"}, nil)
+	c.call("disconnect", nil, nil)
+	if e := <-done; e != nil {
+		t.Fatal(e)
+	}
+
+	// request after disconnect does not block the reader
+	c.send("threads", nil)
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
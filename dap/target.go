@@ -0,0 +1,390 @@
+package dap
+
+import (
+	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/debugger"
+	"git.andmed.org/nand2tetris/vm"
+	"git.andmed.org/nand2tetris/vmtranslator"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// words shown for segments of unknown size
+const segmentWords = 8
+
+// location is a line of source file, path is absolute
+type location struct {
+	path string
+	line int
+}
+
+// frame is a function call with its segments
+type frame struct {
+	name   string
+	loc    location
+	scopes []scope
+}
+
+// scope is a VM segment shown as variables
+type scope struct {
+	name string
+	vars []Variable
+}
+
+// target is a program on an emulator
+type target interface {
+	step() error
+	ended() (bool, int)      // program stopped and its exit code
+	position() location      // of next instruction
+	statement() bool         // next instruction starts a source line
+	depth() int              // calls in progress
+	lines() map[string][]int // sorted lines of statements by path
+	frames() []frame         // innermost first
+	output() string          // text printed since last call
+}
+
+// load starts program: directory of Jack or VM files and .vm files run on the VM emulator,
+// .asm on the CPU emulator
+func load(path string) (target, error) {
+	path, e := filepath.Abs(path)
+	if e != nil {
+		return nil, e
+	}
+	stat, e := os.Stat(path)
+	if e != nil {
+		return nil, e
+	}
+	switch {
+	case stat.IsDir(), filepath.Ext(path) == ".vm":
+		return loadVM(path, stat.IsDir())
+	case filepath.Ext(path) == ".asm":
+		return loadAsm(path)
+	}
+	return nil, fmt.Errorf("%s: expecting directory, .vm or .asm file", path)
+}
+
+// vmTarget runs Jack and VM code with Go OS
+type vmTarget struct {
+	m       *vm.Machine
+	os      *vm.OS
+	src     *compiler.SourceMap // nil without Jack files
+	printed int
+	locs    []location // by command
+	stmts   []bool
+	statics map[string]int // VM file -> statics used
+}
+
+func loadVM(path string, dir bool) (*vmTarget, error) {
+	t := &vmTarget{m: vm.New(), statics: map[string]int{}}
+	base := filepath.Dir(path)
+	if dir {
+		base = path
+		filenames, _ := filepath.Glob(filepath.Join(path, "*.jack"))
+		if len(filenames) > 0 {
+			t.src = compiler.NewSourceMap()
+		}
+		for _, filename := range filenames {
+			if e := compiler.CompilePath(filename, compiler.Options{Checks: &compiler.Checks{}, Source: t.src}); e != nil {
+				return nil, e
+			}
+		}
+	}
+	t.os = t.m.UseOS()
+	if e := t.m.LoadPath(path); e != nil {
+		return nil, e
+	}
+	if e := t.m.Start(); e != nil {
+		return nil, e
+	}
+	for i, c := range t.m.Program {
+		loc := location{filepath.Join(base, c.File), c.Line}
+		if t.src != nil {
+			class := strings.TrimSuffix(c.File, ".vm")
+			if lines := t.src.Lines[class]; c.Line <= len(lines) {
+				loc = location{filepath.Join(base, t.src.Files[class]), lines[c.Line-1]}
+			}
+		}
+		t.locs = append(t.locs, loc)
+		t.stmts = append(t.stmts, loc.line > 0 && (i == 0 || t.locs[i-1] != loc || c.Type == vmtranslator.CmdFunction))
+		if (c.Type == vmtranslator.CmdPush || c.Type == vmtranslator.CmdPop) && c.Arg1 == "static" && c.Arg2 >= t.statics[c.File] {
+			t.statics[c.File] = c.Arg2 + 1
+		}
+	}
+	return t, nil
+}
+
+func (t *vmTarget) step() error { return t.m.Step() }
+
+func (t *vmTarget) ended() (bool, int) {
+	switch t.m.Status {
+	case vm.Halted:
+		return true, 0
+	case vm.Failed:
+		return true, int(t.m.ErrorCode)
+	}
+	return false, 0
+}
+
+func (t *vmTarget) position() location {
+	if t.m.PC < len(t.locs) {
+		return t.locs[t.m.PC]
+	}
+	return location{}
+}
+
+func (t *vmTarget) statement() bool {
+	return t.m.PC < len(t.stmts) && t.stmts[t.m.PC]
+}
+
+func (t *vmTarget) depth() int { return len(t.m.Frames) }
+
+func (t *vmTarget) lines() map[string][]int {
+	return statementLines(t.locs, t.stmts)
+}
+
+func (t *vmTarget) output() string {
+	text := t.os.Text()
+	s := text[t.printed:]
+	t.printed = len(text)
+	return s
+}
+
+// frames follow saved LCL, ARG and THIS below the locals of each call
+func (t *vmTarget) frames() []frame {
+	m := t.m
+	ram := m.RAM[:]
+	lcl, arg, this := int(ram[vm.LCL]), int(ram[vm.ARG]), int(ram[vm.THIS])
+	if len(m.Frames) == 0 {
+		return []frame{t.frame(m.Function(), m.PC, lcl, arg, this)}
+	}
+	var frames []frame
+	pc := m.PC
+	for i := len(m.Frames) - 1; i >= 0; i-- {
+		frames = append(frames, t.frame(m.Frames[i].Function, pc, lcl, arg, this))
+		if lcl < 5 || lcl >= vm.RAMSize {
+			break
+		}
+		pc = m.Frames[i].Return - 1 // the call
+		lcl, arg, this = int(ram[lcl-4]), int(ram[lcl-3]), int(ram[lcl-2])
+	}
+	return frames
+}
+
+func (t *vmTarget) frame(name string, pc, lcl, arg, this int) frame {
+	f := frame{name: name}
+	if 0 <= pc && pc < len(t.m.Program) {
+		f.loc = t.locs[pc]
+		f.scopes = t.scopes(pc, lcl, arg, this)
+	}
+	return f
+}
+
+// scopes of function running command pc, Jack variables are named
+func (t *vmTarget) scopes(pc, lcl, arg, this int) []scope {
+	m := t.m
+	c := m.Program[pc]
+	start := pc
+	for start > 0 && m.Program[start].Type != vmtranslator.CmdFunction {
+		start--
+	}
+	locals := m.Program[start].Arg2
+	args := lcl - 5 - arg
+	fields := segmentWords
+	var fn *compiler.Function
+	var class *compiler.Class
+	if t.src != nil {
+		fn = t.src.Functions[c.Function]
+		class = t.src.Classes[strings.TrimSuffix(c.File, ".vm")]
+	}
+	names := map[string][]compiler.Var{}
+	if fn != nil {
+		names["local"], names["argument"] = fn.Locals, fn.Args
+		if class != nil {
+			names["static"] = class.Statics
+			fields = 0
+			if fn.Kind != "function" {
+				names["this"] = class.Fields
+				fields = len(class.Fields)
+			}
+		}
+	}
+	if this == 0 {
+		fields = 0
+	}
+	return []scope{
+		{"local", words(m.RAM[:], lcl, locals, names["local"])},
+		{"argument", words(m.RAM[:], arg, args, names["argument"])},
+		{"this", words(m.RAM[:], this, fields, names["this"])},
+		{"static", words(m.RAM[:], m.StaticBase(pc), t.statics[c.File], names["static"])},
+		{"temp", words(m.RAM[:], vm.Temp, 8, nil)},
+	}
+}
+
+// asmTarget runs assembly on the CPU emulator
+type asmTarget struct {
+	d    *debugger.Debugger
+	locs []location // by ROM address
+}
+
+func loadAsm(path string) (*asmTarget, error) {
+	file, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer file.Close()
+	var a assembler.Assembler
+	if e := a.Parse(file); e != nil {
+		return nil, fmt.Errorf("%s: %s", path, e)
+	}
+	c := &cpu.Computer{}
+	c.Load(a.Code)
+	t := &asmTarget{d: debugger.New(c, a.Symbols())}
+	for _, line := range a.Lines {
+		t.locs = append(t.locs, location{path, line})
+	}
+	return t, nil
+}
+
+func (t *asmTarget) step() error {
+	t.d.Step()
+	return nil
+}
+
+func (t *asmTarget) ended() (bool, int) { return t.d.CPU.Halted(), 0 }
+
+func (t *asmTarget) position() location {
+	if pc := int(t.d.CPU.PC); pc < len(t.locs) {
+		return t.locs[pc]
+	}
+	return location{}
+}
+
+func (t *asmTarget) statement() bool { return int(t.d.CPU.PC) < len(t.locs) }
+
+func (t *asmTarget) depth() int { return len(t.d.Frames()) }
+
+func (t *asmTarget) lines() map[string][]int {
+	stmts := make([]bool, len(t.locs))
+	for i := range stmts {
+		stmts[i] = true
+	}
+	return statementLines(t.locs, stmts)
+}
+
+func (t *asmTarget) output() string { return "" }
+
+// frames are VM calls of translated code, plain assembly has one frame
+func (t *asmTarget) frames() []frame {
+	ram := t.d.CPU.RAM[:]
+	vmFrames := t.d.Frames()
+	if len(vmFrames) == 0 {
+		vmFrames = []debugger.Frame{{Function: "main", PC: t.d.CPU.PC,
+			LCL: ram[vm.LCL], ARG: ram[vm.ARG], THIS: ram[vm.THIS], THAT: ram[vm.THAT]}}
+	}
+	var frames []frame
+	for i, vf := range vmFrames {
+		pc := int(vf.PC)
+		if i > 0 && pc > 0 {
+			pc-- // the jump of the call
+		}
+		f := frame{name: vf.Function}
+		if pc < len(t.locs) {
+			f.loc = t.locs[pc]
+		}
+		this := 0
+		if vf.THIS != 0 {
+			this = segmentWords
+		}
+		f.scopes = []scope{
+			{"local", values(vf.Locals, nil)},
+			{"argument", values(vf.Args, nil)},
+			{"this", words(ram, int(vf.THIS), this, nil)},
+			{"static", t.statics(vf.Function)},
+			{"temp", words(ram, vm.Temp, 8, nil)},
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// statics are assembler variables Class.i of the function's class,
+// all variables for code not translated from VM
+func (t *asmTarget) statics(fn string) []Variable {
+	prefix := ""
+	if i := strings.Index(fn, "."); i >= 0 {
+		prefix = fn[:i+1]
+	}
+	type static struct {
+		name  string
+		index int
+		addr  int
+	}
+	var statics []static
+	for name, addr := range t.d.Symbols.Vars {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		index, e := strconv.Atoi(name[len(prefix):])
+		if prefix != "" && e != nil {
+			continue
+		}
+		statics = append(statics, static{name[len(prefix):], index, addr})
+	}
+	sort.Slice(statics, func(i, j int) bool {
+		if statics[i].index != statics[j].index {
+			return statics[i].index < statics[j].index
+		}
+		return statics[i].name < statics[j].name
+	})
+	var vars []Variable
+	for _, s := range statics {
+		vars = append(vars, Variable{Name: s.name, Value: strconv.Itoa(int(t.d.CPU.RAM[s.addr]))})
+	}
+	return vars
+}
+
+// words shows n words of RAM from base, Jack variables by their index
+func words(ram []int16, base, n int, jack []compiler.Var) []Variable {
+	if base < 0 || n < 0 || base+n > len(ram) {
+		return nil
+	}
+	return values(ram[base:base+n], jack)
+}
+
+func values(ws []int16, jack []compiler.Var) []Variable {
+	byIndex := map[int]compiler.Var{}
+	for _, v := range jack {
+		byIndex[v.Index] = v
+	}
+	vars := []Variable{}
+	for i, w := range ws {
+		if v, ok := byIndex[i]; ok {
+			vars = append(vars, Variable{Name: v.Name, Value: debugger.Format(v.Type, w), Type: v.Type})
+		} else {
+			vars = append(vars, Variable{Name: strconv.Itoa(i), Value: strconv.Itoa(int(w))})
+		}
+	}
+	return vars
+}
+
+// statementLines collects lines of statements by path
+func statementLines(locs []location, stmts []bool) map[string][]int {
+	seen := map[location]bool{}
+	lines := map[string][]int{}
+	for i, loc := range locs {
+		if stmts[i] && !seen[loc] {
+			seen[loc] = true
+			lines[loc.path] = append(lines[loc.path], loc.line)
+		}
+	}
+	for _, l := range lines {
+		sort.Ints(l)
+	}
+	return lines
+}
@@ -0,0 +1,23 @@
+// sum = 1 + 2 + ... + 10
+    @sum
+    M=0
+    @i
+    M=1
+(LOOP)
+    @i
+    D=M
+    @11
+    D=D-A
+    @END
+    D;JEQ
+    @i
+    D=M
+    @sum
+    M=D+M
+    @i
+    M=M+1
+    @LOOP
+    0;JMP
+(END)
+    @END
+    0;JMP
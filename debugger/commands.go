@@ -0,0 +1,243 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"git.andmed.org/nand2tetris/vm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const help = `commands:
+  break|b <addr|label|File.jack:line>
+                          set breakpoint
+  delete|d <addr|label|File.jack:line>
+                          remove breakpoint
+  watch|w <addr|var>      stop when RAM changes
+  unwatch <addr|var>      remove watchpoint
+  info                    list breakpoints and watchpoints
+  step|s [n]              run n Jack statements, instructions without debug info
+  next|n                  run to next Jack statement, stepping over calls
+  stepi|si [n]            execute n instructions
+  nexti|ni                step over VM call
+  finish|f                run until current function returns
+  continue|c              run to breakpoint, watchpoint or halt
+  regs|r                  show A, D, PC and VM pointers
+  stack                   show VM working stack of current function
+  frames                  show VM call frames
+  bt                      show Jack backtrace, VM frames without debug info
+  vars|v [frame]          show Jack arguments, locals, fields and statics
+  x <addr|var> [n]        show n words of RAM
+  list|l [n]              show n instructions from PC
+  quit|q                  exit`
+
+// Run reads commands from r and writes results to w until quit or end of input
+func (d *Debugger) Run(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	bw := bufio.NewWriter(w)
+	d.where(bw)
+	for {
+		fmt.Fprint(bw, "(hackdbg) ")
+		if e := bw.Flush(); e != nil {
+			return e
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "q" {
+			return bw.Flush()
+		}
+		if e := d.Exec(bw, args); e != nil {
+			fmt.Fprintln(bw, e)
+		}
+	}
+}
+
+// Exec executes one command
+func (d *Debugger) Exec(w io.Writer, args []string) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "break", "b", "delete", "d":
+		if len(args) != 1 {
+			return fmt.Errorf("%s: expecting address, label or Jack line", cmd)
+		}
+		addrs, e := d.addresses(args[0])
+		if e != nil {
+			return e
+		}
+		for _, addr := range addrs {
+			if cmd[0] == 'b' {
+				d.Break(addr)
+				fmt.Fprintf(w, "breakpoint at %d %s\n", addr, d.location(addr))
+			} else {
+				d.Clear(addr)
+			}
+		}
+	case "watch", "w", "unwatch":
+		if len(args) != 1 {
+			return fmt.Errorf("%s: expecting RAM address or variable", cmd)
+		}
+		addr, e := d.RAMAddress(args[0])
+		if e != nil {
+			return e
+		}
+		if cmd == "unwatch" {
+			d.Unwatch(addr)
+		} else {
+			d.Watch(addr)
+			fmt.Fprintf(w, "watching RAM[%d] = %d\n", addr, d.CPU.RAM[addr])
+		}
+	case "info":
+		for _, addr := range d.Breakpoints() {
+			fmt.Fprintf(w, "breakpoint %d %s\n", addr, d.location(addr))
+		}
+		for _, addr := range d.Watchpoints() {
+			fmt.Fprintf(w, "watchpoint RAM[%d] = %d\n", addr, d.CPU.RAM[addr])
+		}
+	case "step", "s", "stepi", "si":
+		n, e := count(args)
+		if e != nil {
+			return e
+		}
+		step := d.StepStatement
+		if cmd == "stepi" || cmd == "si" {
+			step = d.Step
+		}
+		stop := Stop{Reason: Stepped}
+		for i := 0; i < n && stop.Reason == Stepped; i++ {
+			stop = step()
+		}
+		d.report(w, stop)
+	case "next", "n":
+		d.report(w, d.NextStatement())
+	case "nexti", "ni":
+		d.report(w, d.Next())
+	case "finish", "f":
+		d.report(w, d.Out())
+	case "continue", "c":
+		d.report(w, d.Continue())
+	case "regs", "r":
+		c := d.CPU
+		fmt.Fprintf(w, "A=%d D=%d PC=%d cycles=%d\n", c.A, c.D, c.PC, c.Cycles)
+		fmt.Fprintf(w, "SP=%d LCL=%d ARG=%d THIS=%d THAT=%d\n",
+			c.RAM[vm.SP], c.RAM[vm.LCL], c.RAM[vm.ARG], c.RAM[vm.THIS], c.RAM[vm.THAT])
+	case "stack":
+		if frames := d.Frames(); len(frames) > 0 {
+			f := frames[0]
+			for i, v := range f.Locals {
+				fmt.Fprintf(w, "%5d: %d\n", int(f.LCL)+i, v)
+			}
+		}
+	case "bt":
+		if d.Info != nil {
+			for _, s := range d.Backtrace() {
+				fmt.Fprintln(w, s)
+			}
+			break
+		}
+		fallthrough
+	case "frames":
+		for i, f := range d.Frames() {
+			fmt.Fprintf(w, "#%d %s at %s LCL=%d ARG=%d THIS=%d THAT=%d\n", i, f.Function, d.Location(f.PC), f.LCL, f.ARG, f.THIS, f.THAT)
+			fmt.Fprintf(w, "   args %v\n   locals %v\n", f.Args, f.Locals)
+		}
+	case "vars", "v":
+		if d.Info == nil {
+			return fmt.Errorf("%s: no debug info", cmd)
+		}
+		frame := 0
+		if len(args) > 0 {
+			var e error
+			if frame, e = strconv.Atoi(args[0]); e != nil || frame < 0 {
+				return fmt.Errorf("bad frame '%s'", args[0])
+			}
+		}
+		for _, v := range d.Variables(frame) {
+			fmt.Fprintf(w, "%-8s %s\n", v.Segment, v)
+		}
+	case "x":
+		if len(args) < 1 {
+			return fmt.Errorf("x: expecting RAM address or variable")
+		}
+		addr, e := d.RAMAddress(args[0])
+		if e != nil {
+			return e
+		}
+		n, e := count(args[1:])
+		if e != nil {
+			return e
+		}
+		for i := addr; i < addr+n && i < len(d.CPU.RAM); i++ {
+			fmt.Fprintf(w, "RAM[%d] = %d\n", i, d.CPU.RAM[i])
+		}
+	case "list", "l":
+		n, e := count(args)
+		if e != nil {
+			return e
+		}
+		for addr := int(d.CPU.PC); addr < int(d.CPU.PC)+n && addr < len(d.CPU.ROM); addr++ {
+			fmt.Fprintf(w, "%5d %-20s %s\n", addr, d.Location(uint16(addr)), d.Instruction(uint16(addr)))
+		}
+	case "help", "h":
+		fmt.Fprintln(w, help)
+	default:
+		return fmt.Errorf("unknown command '%s', try help", cmd)
+	}
+	return nil
+}
+
+func count(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, e := strconv.Atoi(args[0])
+	if e != nil || n < 1 {
+		return 0, fmt.Errorf("bad count '%s'", args[0])
+	}
+	return n, nil
+}
+
+func (d *Debugger) report(w io.Writer, stop Stop) {
+	switch stop.Reason {
+	case Breakpoint:
+		fmt.Fprint(w, "breakpoint, ")
+	case Watchpoint:
+		fmt.Fprintf(w, "RAM[%d] %d -> %d, ", stop.Addr, stop.Old, stop.New)
+	case Halted:
+		fmt.Fprint(w, "halted, ")
+	case Limit:
+		fmt.Fprint(w, "cycle limit, ")
+	}
+	d.where(w)
+}
+
+// where shows instruction at PC and its Jack line
+func (d *Debugger) where(w io.Writer) {
+	pc := d.CPU.PC
+	fmt.Fprintf(w, "%d %s: %s\n", pc, d.location(pc), d.Instruction(pc))
+}
+
+// addresses resolves all statements of a Jack line, or one address or label
+func (d *Debugger) addresses(loc string) ([]uint16, error) {
+	if strings.Contains(loc, ".jack:") {
+		return d.SourceAddresses(loc)
+	}
+	addr, e := d.Address(loc)
+	if e != nil {
+		return nil, e
+	}
+	return []uint16{addr}, nil
+}
+
+// location shows ROM address as label+offset with Jack position when known
+func (d *Debugger) location(addr uint16) string {
+	if pos := d.Source(addr); pos != "" {
+		return d.Location(addr) + " " + pos
+	}
+	return d.Location(addr)
+}
@@ -0,0 +1,356 @@
+// Package debugger controls the HACK CPU emulator: breakpoints, stepping, watchpoints
+// and the VM stack and call frames of translated code
+package debugger
+
+import (
+	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/debuginfo"
+	"git.andmed.org/nand2tetris/vm"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Reason why execution stopped
+type Reason int
+
+// stop reasons
+const (
+	Stepped Reason = iota
+	Breakpoint
+	Watchpoint
+	Halted
+	Limit // cycle limit reached
+)
+
+// Stop tells where and why execution stopped
+type Stop struct {
+	Reason
+	PC       uint16
+	Addr     int // RAM address of watchpoint
+	Old, New int16
+}
+
+// Frame is a VM function call decoded from the stack, as the translator builds it:
+// return address, LCL, ARG, THIS and THAT of the caller are saved below LCL
+type Frame struct {
+	Function string
+	PC       uint16 // current instruction or return address
+	LCL, ARG int16
+	THIS     int16
+	THAT     int16
+	Args     []int16
+	Locals   []int16 // locals and working stack
+}
+
+// Debugger runs CPU until breakpoint, watchpoint, halt or cycle limit
+type Debugger struct {
+	CPU     *cpu.Computer
+	Symbols assembler.Symbols
+	Limit   uint64          // cycles per continue, 0 for no limit
+	Info    *debuginfo.Info // Jack sources, nil for assembly only
+
+	breaks    map[uint16]bool
+	watches   map[int]int16 // address -> last value
+	labels    []int         // sorted ROM addresses of labels
+	names     map[int]string
+	functions []int          // sorted ROM addresses of VM functions
+	routines  map[int16]bool // ROM addresses of compact mode routines
+}
+
+// New returns debugger of computer with loaded program and its symbols
+func New(c *cpu.Computer, syms assembler.Symbols) *Debugger {
+	d := &Debugger{
+		CPU:      c,
+		Symbols:  syms,
+		breaks:   map[uint16]bool{},
+		watches:  map[int]int16{},
+		names:    map[int]string{},
+		routines: map[int16]bool{},
+	}
+	for _, name := range []string{"$CALL", "$EQ", "$GT", "$LT"} {
+		if addr, ok := syms.Labels[name]; ok {
+			d.routines[int16(addr)] = true
+		}
+	}
+	for name, addr := range syms.Labels {
+		if old, ok := d.names[addr]; !ok || better(name, old) {
+			d.names[addr] = name
+		}
+	}
+	for addr, name := range d.names {
+		d.labels = append(d.labels, addr)
+		if isFunction(name) {
+			d.functions = append(d.functions, addr)
+		}
+	}
+	sort.Ints(d.labels)
+	sort.Ints(d.functions)
+	return d
+}
+
+// isFunction tells VM function labels, Class.name, from labels inside functions
+func isFunction(name string) bool {
+	return strings.Contains(name, ".") && !strings.Contains(name, "$")
+}
+
+// better prefers function labels and then shorter names for an address
+func better(name, old string) bool {
+	if isFunction(name) != isFunction(old) {
+		return isFunction(name)
+	}
+	if len(name) != len(old) {
+		return len(name) < len(old)
+	}
+	return name < old
+}
+
+// Address resolves ROM address, label or Jack position File.jack:line
+func (d *Debugger) Address(loc string) (uint16, error) {
+	if strings.Contains(loc, ".jack:") {
+		addrs, e := d.SourceAddresses(loc)
+		if e != nil {
+			return 0, e
+		}
+		return addrs[0], nil
+	}
+	if addr, ok := d.Symbols.Labels[loc]; ok {
+		return uint16(addr), nil
+	}
+	addr, e := strconv.Atoi(loc)
+	if e != nil || addr < 0 || addr >= cpu.ROMSize {
+		return 0, fmt.Errorf("no label or address '%s'", loc)
+	}
+	return uint16(addr), nil
+}
+
+// RAMAddress resolves RAM address, variable or predefined symbol as SP or KBD
+func (d *Debugger) RAMAddress(loc string) (int, error) {
+	if addr, ok := d.Symbols.Vars[loc]; ok {
+		return addr, nil
+	}
+	if addr, ok := ramNames[loc]; ok {
+		return addr, nil
+	}
+	addr, e := strconv.Atoi(loc)
+	if e != nil || addr < 0 || addr >= cpu.RAMSize {
+		return 0, fmt.Errorf("no variable or address '%s'", loc)
+	}
+	return addr, nil
+}
+
+var ramNames = map[string]int{
+	"SP":     vm.SP,
+	"LCL":    vm.LCL,
+	"ARG":    vm.ARG,
+	"THIS":   vm.THIS,
+	"THAT":   vm.THAT,
+	"SCREEN": cpu.Screen,
+	"KBD":    cpu.Keyboard,
+}
+
+// Break sets breakpoint
+func (d *Debugger) Break(addr uint16) {
+	d.breaks[addr] = true
+}
+
+// Clear removes breakpoint
+func (d *Debugger) Clear(addr uint16) {
+	delete(d.breaks, addr)
+}
+
+// Breakpoints returns breakpoint addresses, sorted
+func (d *Debugger) Breakpoints() []uint16 {
+	var addrs []uint16
+	for addr := range d.breaks {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Watch stops execution when RAM at addr changes
+func (d *Debugger) Watch(addr int) {
+	d.watches[addr] = d.CPU.RAM[addr]
+}
+
+// Unwatch removes watchpoint
+func (d *Debugger) Unwatch(addr int) {
+	delete(d.watches, addr)
+}
+
+// Watchpoints returns watched addresses, sorted
+func (d *Debugger) Watchpoints() []int {
+	var addrs []int
+	for addr := range d.watches {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	return addrs
+}
+
+// step executes one instruction, checking watchpoints
+func (d *Debugger) step() (Stop, bool) {
+	d.CPU.Step()
+	for addr, old := range d.watches {
+		if v := d.CPU.RAM[addr]; v != old {
+			d.watches[addr] = v
+			return Stop{Reason: Watchpoint, PC: d.CPU.PC, Addr: addr, Old: old, New: v}, true
+		}
+	}
+	return Stop{}, false
+}
+
+// Step executes one instruction
+func (d *Debugger) Step() Stop {
+	if d.CPU.Halted() {
+		return Stop{Reason: Halted, PC: d.CPU.PC}
+	}
+	if stop, ok := d.step(); ok {
+		return stop
+	}
+	return Stop{Reason: Stepped, PC: d.CPU.PC}
+}
+
+// Continue runs until breakpoint, watchpoint, halt or the cycle limit
+func (d *Debugger) Continue() Stop {
+	return d.runUntil(func() bool { return false })
+}
+
+// Next steps over calls: at the jump of a call sequence it runs until the call returns,
+// other instructions are single stepped
+func (d *Debugger) Next() Stop {
+	ret, lcl, ok := d.callAt()
+	if !ok {
+		return d.Step()
+	}
+	c := d.CPU
+	return d.runUntil(func() bool { return c.PC == ret && c.RAM[vm.LCL] == lcl })
+}
+
+// callAt detects jump to function of VM call: the translator pushes the return address
+// and saved LCL of the caller, sets LCL to SP and jumps, the return address is the next instruction;
+// in compact mode the jump goes to the call or a comparison routine with the return address in R15
+func (d *Debugger) callAt() (ret uint16, lcl int16, ok bool) {
+	c := d.CPU
+	if c.ROM[c.PC]&0xe007 != 0xe007 {
+		return 0, 0, false
+	}
+	if d.routines[c.A] && c.RAM[15] == int16(c.PC+1) {
+		return c.PC + 1, c.RAM[vm.LCL], true
+	}
+	sp := int(c.RAM[vm.SP])
+	if sp < vm.Stack+5 || sp >= cpu.RAMSize || c.RAM[vm.LCL] != int16(sp) || c.RAM[sp-5] != int16(c.PC+1) {
+		return 0, 0, false
+	}
+	return c.PC + 1, c.RAM[sp-4], true
+}
+
+// Out runs until the current function returns
+func (d *Debugger) Out() Stop {
+	frames := d.Frames()
+	if len(frames) < 2 {
+		return d.Continue()
+	}
+	c := d.CPU
+	ret, lcl := frames[1].PC, frames[1].LCL
+	return d.runUntil(func() bool { return c.PC == ret && c.RAM[vm.LCL] == lcl })
+}
+
+// runUntil executes at least one instruction and stops when done is true
+func (d *Debugger) runUntil(done func() bool) Stop {
+	c := d.CPU
+	for n := uint64(0); d.Limit == 0 || n < d.Limit; n++ {
+		if c.Halted() {
+			return Stop{Reason: Halted, PC: c.PC}
+		}
+		if stop, ok := d.step(); ok {
+			return stop
+		}
+		if done() {
+			return Stop{Reason: Stepped, PC: c.PC}
+		}
+		if d.breaks[c.PC] {
+			return Stop{Reason: Breakpoint, PC: c.PC}
+		}
+	}
+	return Stop{Reason: Limit, PC: c.PC}
+}
+
+// Location returns ROM address as label+offset
+func (d *Debugger) Location(addr uint16) string {
+	i := sort.SearchInts(d.labels, int(addr)+1) - 1
+	if i < 0 {
+		return strconv.Itoa(int(addr))
+	}
+	name := d.names[d.labels[i]]
+	if off := int(addr) - d.labels[i]; off > 0 {
+		return fmt.Sprintf("%s+%d", name, off)
+	}
+	return name
+}
+
+// Function returns VM function containing ROM address
+func (d *Debugger) Function(addr uint16) string {
+	i := sort.SearchInts(d.functions, int(addr)+1) - 1
+	if i < 0 {
+		return ""
+	}
+	return d.names[d.functions[i]]
+}
+
+// Instruction returns ROM word at address in assembly
+func (d *Debugger) Instruction(addr uint16) string {
+	word := d.CPU.ROM[addr]
+	if word&0x8000 == 0 {
+		return fmt.Sprintf("@%d", word)
+	}
+	if s, ok := assembler.Decode(word); ok {
+		return s
+	}
+	return assembler.Data(word, int(addr))
+}
+
+// Frames decodes VM call frames from the stack, innermost first; the chain ends
+// at LCL below the stack base, bootstrap jumps to Sys.init with zero pointers
+func (d *Debugger) Frames() []Frame {
+	ram := d.CPU.RAM[:]
+	var frames []Frame
+	pc := d.CPU.PC
+	lcl, arg := ram[vm.LCL], ram[vm.ARG]
+	this, that := ram[vm.THIS], ram[vm.THAT]
+	top := ram[vm.SP]
+	for len(frames) < maxFrames {
+		f := Frame{
+			Function: d.Function(pc),
+			PC:       pc,
+			LCL:      lcl,
+			ARG:      arg,
+			THIS:     this,
+			THAT:     that,
+		}
+		if f.Function == "" {
+			break
+		}
+		valid := vm.Stack+5 <= lcl && lcl <= top && top <= cpu.Screen
+		if valid {
+			if vm.Stack <= arg && arg <= lcl-5 {
+				f.Args = append(f.Args, ram[arg:lcl-5]...)
+			}
+			f.Locals = append(f.Locals, ram[lcl:top]...)
+		}
+		frames = append(frames, f)
+		if !valid {
+			break
+		}
+		top = arg
+		pc = uint16(ram[lcl-5])
+		lcl, arg, this, that = ram[lcl-4], ram[lcl-3], ram[lcl-2], ram[lcl-1]
+	}
+	return frames
+}
+
+// frames decoded at most, guards against broken stack
+const maxFrames = 1000
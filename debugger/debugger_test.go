@@ -0,0 +1,117 @@
+package debugger
+
+import (
+	"bytes"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/vm"
+	"git.andmed.org/nand2tetris/vmtranslator"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fibonacci(t *testing.T) *Debugger {
+	return translate(t, false)
+}
+
+func translate(t *testing.T, compact bool) *Debugger {
+	var b vmtranslator.VMTranslator
+	b.Compact = compact
+	vmtranslator.Bootstrap(&b)
+	filenames, _ := filepath.Glob("../testdata/FunctionCalls/FibonacciElement/*.vm")
+	for _, filename := range filenames {
+		if _, ok := vmtranslator.TranslateFile(&b, filename); !ok {
+			t.Fatal(filename)
+		}
+	}
+	var c cpu.Computer
+	syms, e := c.LoadAsm(strings.NewReader(b.String()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	return New(&c, syms)
+}
+
+func TestBreakpoint(t *testing.T) {
+	d := fibonacci(t)
+	addr, e := d.Address("Main.fibonacci")
+	if e != nil {
+		t.Fatal(e)
+	}
+	d.Break(addr)
+	if stop := d.Continue(); stop.Reason != Breakpoint || stop.PC != addr {
+		t.Fatalf("%+v", stop)
+	}
+	frames := d.Frames()
+	if len(frames) != 2 || frames[0].Function != "Main.fibonacci" || frames[1].Function != "Sys.init" ||
+		len(frames[0].Args) != 1 || frames[0].Args[0] != 4 {
+		t.Fatalf("%+v", frames)
+	}
+	d.Continue()
+	if frames := d.Frames(); len(frames) != 3 || frames[0].Args[0] != 2 || frames[1].Args[0] != 4 {
+		t.Fatalf("%+v", frames)
+	}
+	d.Clear(addr)
+	if stop := d.Out(); stop.Reason != Stepped || d.Function(d.CPU.PC) != "Main.fibonacci" || len(d.Frames()) != 2 {
+		t.Fatalf("%+v in %s", stop, d.Function(d.CPU.PC))
+	}
+}
+
+func TestNext(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		testNext(t, translate(t, compact))
+	}
+}
+
+func testNext(t *testing.T, d *Debugger) {
+	addr, _ := d.Address("Sys.init")
+	d.Break(addr)
+	d.Continue()
+	d.Clear(addr)
+	var calls int
+	for i := 0; i < 1000; i++ {
+		if _, _, ok := d.callAt(); ok {
+			calls++
+		}
+		stop := d.Next()
+		if stop.Reason == Halted {
+			break
+		}
+		if f := d.Function(d.CPU.PC); f != "Sys.init" {
+			t.Fatalf("stepped into %s", f)
+		}
+	}
+	if calls != 1 || d.CPU.RAM[vm.SP] != 262 || d.CPU.RAM[261] != 3 {
+		t.Fatalf("%d calls, SP=%d RAM[261]=%d", calls, d.CPU.RAM[vm.SP], d.CPU.RAM[261])
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	d := fibonacci(t)
+	addr, _ := d.RAMAddress("SP")
+	d.Watch(addr)
+	stop := d.Continue()
+	if stop.Reason != Watchpoint || stop.Addr != vm.SP || stop.New != 256 {
+		t.Fatalf("%+v", stop)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	d := fibonacci(t)
+	var out bytes.Buffer
+	in := "b Main.fibonacci\nc\nbt\nregs\nfoo\nq\nc\n"
+	if e := d.Run(strings.NewReader(in), &out); e != nil {
+		t.Fatal(e)
+	}
+	for _, s := range []string{
+		"breakpoint, 40 Main.fibonacci: @2\n",
+		"#0 Main.fibonacci at Main.fibonacci LCL=267 ARG=261",
+		"#1 Sys.init at ",
+		"SP=267 LCL=267 ARG=261 THIS=0 THAT=0\n",
+		"unknown command 'foo'",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("no %q in\n%s", s, out.String())
+		}
+	}
+}
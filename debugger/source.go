@@ -0,0 +1,186 @@
+package debugger
+
+import (
+	"fmt"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/debuginfo"
+	"git.andmed.org/nand2tetris/vm"
+	"strconv"
+	"strings"
+)
+
+// Value is a Jack variable of a frame with its value
+type Value struct {
+	compiler.Var
+	Addr  int // RAM address, -1 if unknown
+	Value int16
+}
+
+// String formats value by its Jack type
+func (v Value) String() string {
+	if v.Addr < 0 {
+		return fmt.Sprintf("%s %s = ?", v.Type, v.Name)
+	}
+	return fmt.Sprintf("%s %s = %s", v.Type, v.Name, Format(v.Type, v.Value))
+}
+
+// Format shows value as Jack type: characters quoted, booleans as words, objects as addresses
+func Format(typ string, v int16) string {
+	switch typ {
+	case "int":
+		return strconv.Itoa(int(v))
+	case "char":
+		if ' ' <= v && v <= '~' {
+			return fmt.Sprintf("'%c'", v)
+		}
+		return strconv.Itoa(int(v))
+	case "boolean":
+		switch v {
+		case 0:
+			return "false"
+		case -1:
+			return "true"
+		}
+		return strconv.Itoa(int(v))
+	}
+	if v == 0 {
+		return "null"
+	}
+	return fmt.Sprintf("%s@%d", typ, v)
+}
+
+// UseInfo makes debugger work with Jack sources of the program
+func (d *Debugger) UseInfo(info *debuginfo.Info) {
+	d.Info = info
+}
+
+// SourceAddresses resolves Jack position File.jack:line to first addresses of its statements
+func (d *Debugger) SourceAddresses(loc string) ([]uint16, error) {
+	i := strings.LastIndex(loc, ":")
+	if d.Info == nil || i < 0 {
+		return nil, fmt.Errorf("no source position '%s'", loc)
+	}
+	line, e := strconv.Atoi(loc[i+1:])
+	if e != nil {
+		return nil, fmt.Errorf("bad line in '%s'", loc)
+	}
+	var addrs []uint16
+	for _, addr := range d.Info.Statements(loc[:i], line) {
+		addrs = append(addrs, uint16(addr))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no code at '%s'", loc)
+	}
+	return addrs, nil
+}
+
+// Source returns Jack position of ROM address as File.jack:line, empty if unknown
+func (d *Debugger) Source(addr uint16) string {
+	if d.Info == nil {
+		return ""
+	}
+	if l, ok := d.Info.Position(int(addr)); ok && l.File != "" {
+		return fmt.Sprintf("%s:%d", l.File, l.Line)
+	}
+	return ""
+}
+
+// statement is true at the first instruction of a Jack statement
+func (d *Debugger) statement(addr uint16) bool {
+	l, ok := d.Info.Position(int(addr))
+	return ok && l.Stmt && l.Addr == int(addr)
+}
+
+// StepStatement runs to the next Jack statement, into called functions;
+// without debug info it steps one instruction
+func (d *Debugger) StepStatement() Stop {
+	if d.Info == nil {
+		return d.Step()
+	}
+	return d.runUntil(func() bool { return d.statement(d.CPU.PC) })
+}
+
+// NextStatement runs to the next Jack statement of current or calling function
+func (d *Debugger) NextStatement() Stop {
+	if d.Info == nil {
+		return d.Next()
+	}
+	c := d.CPU
+	lcl := c.RAM[vm.LCL]
+	return d.runUntil(func() bool { return d.statement(c.PC) && c.RAM[vm.LCL] <= lcl })
+}
+
+// Variables returns Jack arguments, locals, fields and statics seen in frame,
+// 0 is the innermost one
+func (d *Debugger) Variables(frame int) []Value {
+	frames := d.Frames()
+	if d.Info == nil || frame >= len(frames) {
+		return nil
+	}
+	f := frames[frame]
+	fn := d.Info.Functions[f.Function]
+	if fn == nil {
+		return nil
+	}
+	var values []Value
+	for _, v := range fn.Args {
+		values = append(values, d.value(v, f.ARG, ""))
+	}
+	for _, v := range fn.Locals {
+		values = append(values, d.value(v, f.LCL, ""))
+	}
+	name := strings.Split(f.Function, ".")[0]
+	class := d.Info.Classes[name]
+	if class == nil {
+		return values
+	}
+	if fn.Kind != "function" {
+		for _, v := range class.Fields {
+			values = append(values, d.value(v, f.THIS, ""))
+		}
+	}
+	for _, v := range class.Statics {
+		values = append(values, d.value(v, 0, name))
+	}
+	return values
+}
+
+// value reads variable of segment at base, statics of class
+func (d *Debugger) value(v compiler.Var, base int16, class string) Value {
+	addr := int(base) + v.Index
+	if v.Segment == "static" {
+		var ok bool
+		if addr, ok = d.Info.Vars[fmt.Sprintf("%s.%d", class, v.Index)]; !ok {
+			addr = -1
+		}
+	}
+	if addr < 0 || addr >= len(d.CPU.RAM) {
+		return Value{Var: v, Addr: -1}
+	}
+	return Value{Var: v, Addr: addr, Value: d.CPU.RAM[addr]}
+}
+
+// Backtrace returns Jack call stack, innermost first, as function and position
+func (d *Debugger) Backtrace() []string {
+	var lines []string
+	for i, f := range d.Frames() {
+		pc := f.PC
+		if i > 0 && pc > 0 {
+			pc-- // return address follows the call
+		}
+		pos := d.Source(pc)
+		if pos == "" {
+			pos = d.Location(pc)
+		}
+		var args []string
+		if fn := d.Info.Functions[f.Function]; fn != nil {
+			for j, v := range fn.Args {
+				if j < len(f.Args) {
+					args = append(args, v.Name+"="+Format(v.Type, f.Args[j]))
+				}
+			}
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s(%s) at %s", i, f.Function, strings.Join(args, ", "), pos))
+	}
+	return lines
+}
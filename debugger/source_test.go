@@ -0,0 +1,121 @@
+package debugger
+
+import (
+	"bytes"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/debuginfo"
+	"strings"
+	"testing"
+)
+
+func twice(t *testing.T) *Debugger {
+	return build(t, "../debuginfo/testdata/Twice")
+}
+
+func build(t *testing.T, dir string) *Debugger {
+	a, info, e := debuginfo.Build(dir, compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	var c cpu.Computer
+	c.Load(a.Code)
+	d := New(&c, info.Symbols())
+	d.UseInfo(info)
+	d.Limit = 10000
+	return d
+}
+
+func TestSourceBreakpoint(t *testing.T) {
+	d := twice(t)
+	addr, e := d.Address("Main.jack:17")
+	if e != nil {
+		t.Fatal(e)
+	}
+	d.Break(addr)
+	if stop := d.Continue(); stop.Reason != Breakpoint || d.Source(stop.PC) != "Main.jack:17" {
+		t.Fatalf("%+v at %s", stop, d.Source(stop.PC))
+	}
+	bt := d.Backtrace()
+	if len(bt) != 3 || !strings.HasPrefix(bt[0], "#0 Main.twice(n=3) at Main.jack:17") ||
+		!strings.HasSuffix(bt[1], "at Main.jack:9") || !strings.HasSuffix(bt[2], "at Sys.jack:3") {
+		t.Fatalf("%q", bt)
+	}
+	if _, e := d.Address("Main.jack:99"); e == nil {
+		t.Error("no error past the end")
+	}
+}
+
+func TestStepStatement(t *testing.T) {
+	d := twice(t)
+	addr, _ := d.Address("Main.jack:9")
+	d.Break(addr)
+	d.Continue()
+	d.Clear(addr)
+	var lines []string
+	for i := 0; i < 4; i++ {
+		d.StepStatement()
+		lines = append(lines, d.Source(d.CPU.PC))
+	}
+	if s := strings.Join(lines, " "); s != "Main.jack:15 Main.jack:17 Main.jack:18 Main.jack:10" {
+		t.Errorf("step %s", s)
+	}
+	d.NextStatement()
+	if s := d.Source(d.CPU.PC); s != "Main.jack:11" {
+		t.Errorf("next at %s", s)
+	}
+
+	d = twice(t)
+	d.Break(addr)
+	d.Continue()
+	if d.NextStatement(); d.Source(d.CPU.PC) != "Main.jack:10" {
+		t.Errorf("next over call at %s", d.Source(d.CPU.PC))
+	}
+	d.NextStatement()
+	d.NextStatement()
+	var vars []string
+	for _, v := range d.Variables(0) {
+		vars = append(vars, v.String())
+	}
+	if s := strings.Join(vars, ", "); s != "int a = 3, int b = 6, char c = 'A', int count = 6" {
+		t.Errorf("vars %s", s)
+	}
+}
+
+// TestStatics reads static count of the class of each frame, both are static 0
+func TestStatics(t *testing.T) {
+	d := build(t, "../debuginfo/testdata/Signs")
+	addr, _ := d.Address("Counter.jack:6")
+	d.Break(addr)
+	if stop := d.Continue(); stop.Reason != Breakpoint {
+		t.Fatalf("%+v", stop)
+	}
+	for frame, want := range []string{"int d = -1, int count = 6", "boolean on = true, int n = -5, int count = -5"} {
+		var vars []string
+		for _, v := range d.Variables(frame) {
+			vars = append(vars, v.String())
+		}
+		if s := strings.Join(vars, ", "); s != want {
+			t.Errorf("frame %d vars %s, want %s", frame, s, want)
+		}
+	}
+}
+
+func TestSourceCommands(t *testing.T) {
+	d := twice(t)
+	var out bytes.Buffer
+	in := "b Main.jack:18\nc\nvars\nbt\nq\n"
+	if e := d.Run(strings.NewReader(in), &out); e != nil {
+		t.Fatal(e)
+	}
+	for _, s := range []string{
+		"breakpoint at 297 JUMP3+18 Main.jack:18\n",
+		"argument int n = 3\n",
+		"local    boolean big = true\n",
+		"#1 Main.main() at Main.jack:9\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("no %q in\n%s", s, out.String())
+		}
+	}
+}
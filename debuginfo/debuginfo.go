@@ -0,0 +1,144 @@
+// Package debuginfo maps ROM addresses of a program built from Jack to its VM and Jack sources:
+// compiler source map gives Jack lines of VM code and translator gives ROM addresses of VM commands
+package debuginfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/vmtranslator"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Info is debug info of a program
+type Info struct {
+	Labels    map[string]int                `json:"labels"` // assembler symbols
+	Vars      map[string]int                `json:"vars"`
+	Lines     []Line                        `json:"lines"` // by address
+	Functions map[string]*compiler.Function `json:"functions"`
+	Classes   map[string]*compiler.Class    `json:"classes"`
+}
+
+// Line is source position of ROM addresses from Addr up to the next line
+type Line struct {
+	Addr   int    `json:"addr"`
+	File   string `json:"file,omitempty"` // Jack file, empty for code not compiled from Jack
+	Line   int    `json:"line,omitempty"`
+	VM     string `json:"vm,omitempty"` // VM file, empty for bootstrap
+	VMLine int    `json:"vmLine,omitempty"`
+	Stmt   bool   `json:"stmt,omitempty"` // first instruction of Jack statement
+}
+
+// Build compiles Jack files of dir to VM files next to them, translates all VM files of dir
+// with bootstrap and assembles the result
+func Build(dir string, opts compiler.Options) (*assembler.Assembler, *Info, error) {
+	src := compiler.NewSourceMap()
+	opts.Source = src
+	if opts.Checks == nil {
+		opts.Checks = &compiler.Checks{}
+	}
+	jackFiles, _ := filepath.Glob(filepath.Join(dir, "*.jack"))
+	for _, filename := range jackFiles {
+		if e := compiler.CompilePath(filename, opts); e != nil {
+			return nil, nil, e
+		}
+	}
+	vmFiles, _ := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if len(vmFiles) == 0 {
+		return nil, nil, fmt.Errorf("%s: no .vm files", dir)
+	}
+
+	var b vmtranslator.VMTranslator
+	vmtranslator.Bootstrap(&b)
+	for _, filename := range vmFiles {
+		if _, ok := vmtranslator.TranslateFile(&b, filename); !ok {
+			return nil, nil, fmt.Errorf("%s: translation failed", filename)
+		}
+	}
+
+	var a assembler.Assembler
+	if e := a.Parse(strings.NewReader(b.String())); e != nil {
+		return nil, nil, e
+	}
+	info := &Info{
+		Labels:    a.Labels,
+		Vars:      a.Vars,
+		Functions: src.Functions,
+		Classes:   src.Classes,
+	}
+	// bootstrap up to the first VM command
+	addrs := append([]vmtranslator.Address{{}}, b.Addresses()...)
+	for i, addr := range addrs {
+		// of commands at one address the last one has its instructions
+		if i+1 < len(addrs) && addrs[i+1].Addr == addr.Addr || addr.Addr >= len(a.Code) {
+			continue
+		}
+		l := Line{Addr: addr.Addr}
+		if addr.File != "" {
+			name := strings.TrimSuffix(addr.File, ".vm")
+			l.VM = addr.File
+			l.VMLine = addr.Line
+			if lines := src.Lines[name]; addr.Line <= len(lines) {
+				l.File = src.Files[name]
+				l.Line = lines[addr.Line-1]
+			}
+		}
+		if n := len(info.Lines); l.Line > 0 && (n == 0 || info.Lines[n-1].File != l.File || info.Lines[n-1].Line != l.Line) {
+			l.Stmt = true
+		}
+		info.Lines = append(info.Lines, l)
+	}
+	return &a, info, nil
+}
+
+// Position returns source position of ROM address
+func (info *Info) Position(addr int) (Line, bool) {
+	i := sort.Search(len(info.Lines), func(i int) bool { return info.Lines[i].Addr > addr }) - 1
+	if i < 0 {
+		return Line{}, false
+	}
+	return info.Lines[i], true
+}
+
+// Statements returns first addresses of statements at Jack line of file,
+// or of the nearest following line with code
+func (info *Info) Statements(file string, line int) []int {
+	best := 0
+	for _, l := range info.Lines {
+		if l.Stmt && l.File == file && l.Line >= line && (best == 0 || l.Line < best) {
+			best = l.Line
+		}
+	}
+	var addrs []int
+	for _, l := range info.Lines {
+		if l.Stmt && l.File == file && l.Line == best {
+			addrs = append(addrs, l.Addr)
+		}
+	}
+	return addrs
+}
+
+// Symbols returns assembler symbols of the program
+func (info *Info) Symbols() assembler.Symbols {
+	return assembler.Symbols{Labels: info.Labels, Vars: info.Vars}
+}
+
+// Write writes info as JSON
+func (info *Info) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(info)
+}
+
+// Read reads info written by Write
+func Read(r io.Reader) (*Info, error) {
+	var info Info
+	if e := json.NewDecoder(r).Decode(&info); e != nil {
+		return nil, e
+	}
+	return &info, nil
+}
@@ -0,0 +1,87 @@
+package debuginfo
+
+import (
+	"bytes"
+	"git.andmed.org/nand2tetris/compiler"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	a, info, e := Build("testdata/Twice", compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if l, ok := info.Position(0); !ok || l.File != "" || l.VM != "" {
+		t.Errorf("bootstrap at %+v", l)
+	}
+	addrs := info.Statements("Main.jack", 9)
+	if len(addrs) != 1 {
+		t.Fatalf("statements %v", addrs)
+	}
+	if l, _ := info.Position(addrs[0]); !l.Stmt || l.Line != 9 || l.VM != "Main.vm" || l.VMLine != 4 {
+		t.Errorf("let b at %+v", l)
+	}
+	// blank line goes to the next statement
+	if next := info.Statements("Main.jack", 14); len(next) != 1 || next[0] != info.Labels["Main.twice"] {
+		t.Errorf("line 14 at %v, Main.twice at %d", next, info.Labels["Main.twice"])
+	}
+	if len(a.Lines) == 0 {
+		t.Error("no code")
+	}
+
+	fn := info.Functions["Main.twice"]
+	if fn == nil || fn.Kind != "function" || fn.Line != 15 || len(fn.Args) != 1 || fn.Args[0].Name != "n" ||
+		len(fn.Locals) != 1 || fn.Locals[0] != (compiler.Var{Name: "big", Type: "boolean", Segment: "local", Index: 0}) {
+		t.Errorf("Main.twice %+v", fn)
+	}
+	class := info.Classes["Main"]
+	if class == nil || len(class.Statics) != 1 || len(class.Fields) != 1 || class.Fields[0].Segment != "this" {
+		t.Errorf("Main %+v", class)
+	}
+}
+
+// TestSigns checks that statements after true and negative constants, two VM
+// lines each, start at their own VM code
+func TestSigns(t *testing.T) {
+	_, info, e := Build("testdata/Signs", compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := ioutil.ReadFile("testdata/Signs/Main.vm")
+	if e != nil {
+		t.Fatal(e)
+	}
+	vm := strings.Split(string(data), "\n")
+	for line, first := range map[int]string{7: "push constant 1", 8: "push constant 5", 9: "push local 1",
+		10: "push constant 1", 11: "push constant 0", 12: "push constant 0"} {
+		addrs := info.Statements("Main.jack", line)
+		if len(addrs) != 1 {
+			t.Fatalf("line %d at %v", line, addrs)
+		}
+		l, _ := info.Position(addrs[0])
+		if l.Line != line || l.VM != "Main.vm" || vm[l.VMLine-1] != first {
+			t.Errorf("line %d at %+v: '%s', want '%s'", line, l, vm[l.VMLine-1], first)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	_, info, e := Build("testdata/Twice", compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	var buf bytes.Buffer
+	if e := info.Write(&buf); e != nil {
+		t.Fatal(e)
+	}
+	read, e := Read(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(read, info) {
+		t.Error("read info differs")
+	}
+}
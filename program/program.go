@@ -0,0 +1,91 @@
+// Package program loads a program for the emulators: Jack files of a directory are compiled,
+// VM code runs on the VM emulator with Go OS, ASM and HACK on the CPU emulator
+package program
+
+import (
+	"fmt"
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/cpu"
+	"git.andmed.org/nand2tetris/vm"
+	"os"
+	"path/filepath"
+)
+
+// Program is a loaded program, either VM or CPU is set
+type Program struct {
+	VM      *vm.Machine // started
+	OS      *vm.OS      // of VM
+	CPU     *cpu.Computer
+	Symbols assembler.Symbols // of ASM, empty for HACK
+}
+
+// Load builds program of path as needed: a directory of Jack or VM files, .vm, .asm or .hack file
+func Load(path string, opts compiler.Options) (*Program, error) {
+	stat, e := os.Stat(path)
+	if e != nil {
+		return nil, e
+	}
+	if stat.IsDir() {
+		if e := Compile(path, opts); e != nil {
+			return nil, e
+		}
+	}
+	if stat.IsDir() || filepath.Ext(path) == ".vm" {
+		m := vm.New()
+		p := &Program{VM: m, OS: m.UseOS()}
+		if e := m.LoadPath(path); e != nil {
+			return nil, e
+		}
+		if e := m.Start(); e != nil {
+			return nil, e
+		}
+		return p, nil
+	}
+	if ext := filepath.Ext(path); ext != ".asm" && ext != ".hack" {
+		return nil, fmt.Errorf("%s: expecting directory, .vm, .asm or .hack file", path)
+	}
+	c, syms, e := LoadCPU(path)
+	if e != nil {
+		return nil, e
+	}
+	return &Program{CPU: c, Symbols: syms}, nil
+}
+
+// Compile compiles Jack files of dir to VM files next to them
+func Compile(dir string, opts compiler.Options) error {
+	if opts.Checks == nil {
+		opts.Checks = &compiler.Checks{}
+	}
+	filenames, _ := filepath.Glob(filepath.Join(dir, "*.jack"))
+	for _, filename := range filenames {
+		if e := compiler.CompilePath(filename, opts); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// LoadCPU loads .asm or .hack file on the CPU emulator, symbols are empty for HACK
+func LoadCPU(path string) (*cpu.Computer, assembler.Symbols, error) {
+	var c cpu.Computer
+	var syms assembler.Symbols
+	ext := filepath.Ext(path)
+	if ext != ".asm" && ext != ".hack" {
+		return nil, syms, fmt.Errorf("%s: expecting .asm or .hack file", path)
+	}
+	file, e := os.Open(path)
+	if e != nil {
+		return nil, syms, e
+	}
+	defer file.Close()
+	if ext == ".asm" {
+		syms, e = c.LoadAsm(file)
+	} else {
+		e = c.LoadHack(file)
+	}
+	if e != nil {
+		return nil, syms, fmt.Errorf("%s: %s", path, e)
+	}
+	return &c, syms, nil
+}
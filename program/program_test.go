@@ -0,0 +1,90 @@
+package program
+
+import (
+	"git.andmed.org/nand2tetris/compiler"
+	"git.andmed.org/nand2tetris/vm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tempDir(t *testing.T, files map[string]string) string {
+	dir, e := ioutil.TempDir("", "program")
+	if e != nil {
+		t.Fatal(e)
+	}
+	for name, s := range files {
+		if e := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return dir
+}
+
+func TestLoadJack(t *testing.T) {
+	jack, _ := ioutil.ReadFile("../compiler/test/Seven/Main.jack")
+	dir := tempDir(t, map[string]string{"Main.jack": string(jack)})
+	defer os.RemoveAll(dir)
+	p, e := Load(dir, compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if p.VM == nil || p.CPU != nil {
+		t.Fatal("not loaded on the VM emulator")
+	}
+	p.VM.Run(1000)
+	if p.VM.Status != vm.Halted || p.OS.Text() != "7" {
+		t.Fatalf("status %d text %q", p.VM.Status, p.OS.Text())
+	}
+}
+
+func TestLoadVM(t *testing.T) {
+	p, e := Load("../compiler/test/Seven/Main.vm", compiler.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p.VM.Run(1000)
+	if p.OS.Text() != "7" {
+		t.Fatalf("text %q", p.OS.Text())
+	}
+}
+
+func TestLoadCPU(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"Sum.asm":  "@2\nD=A\n@3\nD=D+A\n@0\nM=D\n(END)\n@END\n0;JMP\n",
+		"Sum.hack": "0000000000000010\n1110110000010000\n0000000000000000\n1110001100001000\n",
+		"Sum.txt":  "",
+		"Bad.asm":  "@2\nD=X\n",
+	})
+	defer os.RemoveAll(dir)
+	for name, want := range map[string]int16{"Sum.asm": 5, "Sum.hack": 2} {
+		p, e := Load(filepath.Join(dir, name), compiler.Options{})
+		if e != nil {
+			t.Fatal(e)
+		}
+		p.CPU.Run(100)
+		if p.VM != nil || p.CPU.RAM[0] != want {
+			t.Errorf("%s: RAM[0] = %d", name, p.CPU.RAM[0])
+		}
+	}
+	p, _ := Load(filepath.Join(dir, "Sum.asm"), compiler.Options{})
+	if p.Symbols.Labels["END"] != 6 {
+		t.Errorf("labels %v", p.Symbols.Labels)
+	}
+	for _, name := range []string{"Sum.txt", "Bad.asm", "Missing.asm"} {
+		if _, e := Load(filepath.Join(dir, name), compiler.Options{}); e == nil {
+			t.Errorf("%s loaded", name)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	dir := tempDir(t, map[string]string{"Main.jack": "class Main { function void main() { let = 1; } }"})
+	defer os.RemoveAll(dir)
+	_, e := Load(dir, compiler.Options{})
+	if e == nil || !strings.Contains(e.Error(), "Main.jack: ") {
+		t.Fatalf("got %v", e)
+	}
+}
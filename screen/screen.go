@@ -0,0 +1,83 @@
+// Package screen renders the HACK screen memory map (RAM 16384..24575) as images
+package screen
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// screen memory map, 32 words per row, lowest bit of a word is the leftmost pixel
+const (
+	Width   = 512
+	Height  = 256
+	Address = 16384
+	Size    = Width * Height / 16
+)
+
+var palette = color.Palette{color.White, color.Black}
+
+// Image returns picture of the screen, ram is the whole computer memory
+func Image(ram []int16) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, Width, Height), palette)
+	for i, word := range ram[Address : Address+Size] {
+		for bit := 0; bit < 16; bit++ {
+			if word>>uint(bit)&1 != 0 {
+				img.Pix[i*16+bit] = 1
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes picture of the screen as PNG
+func WritePNG(w io.Writer, ram []int16) error {
+	return png.Encode(w, Image(ram))
+}
+
+// Recorder collects screen frames for animated GIF, unchanged screen is not added again
+// but extends the time the last frame is shown
+type Recorder struct {
+	Delay int // between frames, in 100ths of a second
+
+	anim gif.GIF
+	last []int16
+}
+
+// Add takes a frame if the screen changed since the last one, returns true if it did;
+// otherwise the last frame is shown for Delay longer
+func (r *Recorder) Add(ram []int16) bool {
+	mem := ram[Address : Address+Size]
+	if r.last != nil && equal(r.last, mem) {
+		r.anim.Delay[len(r.anim.Delay)-1] += r.Delay
+		return false
+	}
+	if r.last == nil {
+		r.last = make([]int16, Size)
+	}
+	copy(r.last, mem)
+	r.anim.Image = append(r.anim.Image, Image(ram))
+	r.anim.Delay = append(r.anim.Delay, r.Delay)
+	return true
+}
+
+// Frames returns number of frames taken
+func (r *Recorder) Frames() int {
+	return len(r.anim.Image)
+}
+
+// WriteGIF writes frames as animated GIF, looping forever
+func (r *Recorder) WriteGIF(w io.Writer) error {
+	return gif.EncodeAll(w, &r.anim)
+}
+
+func equal(a, b []int16) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
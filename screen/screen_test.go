@@ -0,0 +1,100 @@
+package screen
+
+import (
+	"bytes"
+	"git.andmed.org/nand2tetris/vm"
+	"image/gif"
+	"image/png"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	ram := make([]int16, Address+Size)
+	ram[Address] = 1              // (0, 0)
+	ram[Address+1] = -0x8000      // (31, 0)
+	ram[Address+Size-1] = -0x8000 // (511, 255)
+	img := Image(ram)
+	for _, p := range [][2]int{{0, 0}, {31, 0}, {511, 255}} {
+		if img.ColorIndexAt(p[0], p[1]) != 1 {
+			t.Errorf("pixel %v not black", p)
+		}
+	}
+	if img.ColorIndexAt(1, 0) != 0 || img.ColorIndexAt(0, 1) != 0 {
+		t.Error("extra pixels")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	ram := make([]int16, Address+Size)
+	r := Recorder{Delay: 10}
+	r.Add(ram)
+	if r.Add(ram) {
+		t.Error("unchanged screen recorded")
+	}
+	ram[Address+100] = 7
+	if !r.Add(ram) || r.Frames() != 2 {
+		t.Error("frame not recorded")
+	}
+	var buf bytes.Buffer
+	if e := r.WriteGIF(&buf); e != nil {
+		t.Fatal(e)
+	}
+	anim, e := gif.DecodeAll(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(anim.Image) != 2 || anim.Delay[0] != 20 || anim.Delay[1] != 10 || anim.Image[1].ColorIndexAt(100%32*16, 100/32) != 1 {
+		t.Error("bad animation")
+	}
+}
+
+func TestRecorderTiming(t *testing.T) {
+	ram := make([]int16, Address+Size)
+	r := Recorder{Delay: 5}
+	// screen changes at samples 0, 4 and 5 of 8
+	for i := 0; i < 8; i++ {
+		if i == 4 || i == 5 {
+			ram[Address] = int16(i)
+		}
+		r.Add(ram)
+	}
+	if !reflect.DeepEqual(r.anim.Delay, []int{20, 5, 15}) {
+		t.Errorf("delays %v", r.anim.Delay)
+	}
+}
+
+// TestPong compares the final screen of Pong with the one in testdata
+func TestPong(t *testing.T) {
+	m := vm.New()
+	m.UseOS()
+	if e := m.LoadPath("../compiler/test/Pong"); e != nil {
+		t.Fatal(e)
+	}
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Run(10000000); e != nil || m.Status != vm.Halted {
+		t.Fatal("not halted", e)
+	}
+	f, e := os.Open("testdata/pong.png")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	want, e := png.Decode(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	got := Image(m.RAM[:])
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			wr, _, _, _ := want.At(x, y).RGBA()
+			gr, _, _, _ := got.At(x, y).RGBA()
+			if wr != gr {
+				t.Fatalf("screen differs at (%d, %d)", x, y)
+			}
+		}
+	}
+}
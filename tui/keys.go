@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"bytes"
+	"time"
+)
+
+// HACK key codes of special keys
+const (
+	KeyNewLine   = 128
+	KeyBackSpace = 129
+	KeyLeft      = 130
+	KeyUp        = 131
+	KeyRight     = 132
+	KeyDown      = 133
+	KeyHome      = 134
+	KeyEnd       = 135
+	KeyPageUp    = 136
+	KeyPageDown  = 137
+	KeyInsert    = 138
+	KeyDelete    = 139
+	KeyEsc       = 140
+	KeyF1        = 141 // F1..F12 are 141..152
+)
+
+// escape sequences of xterm and vt terminals
+var sequences = map[string]int16{
+	"\x1b[A":   KeyUp,
+	"\x1b[B":   KeyDown,
+	"\x1b[C":   KeyRight,
+	"\x1b[D":   KeyLeft,
+	"\x1bOA":   KeyUp,
+	"\x1bOB":   KeyDown,
+	"\x1bOC":   KeyRight,
+	"\x1bOD":   KeyLeft,
+	"\x1b[H":   KeyHome,
+	"\x1b[F":   KeyEnd,
+	"\x1bOH":   KeyHome,
+	"\x1bOF":   KeyEnd,
+	"\x1b[1~":  KeyHome,
+	"\x1b[4~":  KeyEnd,
+	"\x1b[7~":  KeyHome,
+	"\x1b[8~":  KeyEnd,
+	"\x1b[2~":  KeyInsert,
+	"\x1b[3~":  KeyDelete,
+	"\x1b[5~":  KeyPageUp,
+	"\x1b[6~":  KeyPageDown,
+	"\x1bOP":   KeyF1,
+	"\x1bOQ":   KeyF1 + 1,
+	"\x1bOR":   KeyF1 + 2,
+	"\x1bOS":   KeyF1 + 3,
+	"\x1b[11~": KeyF1,
+	"\x1b[12~": KeyF1 + 1,
+	"\x1b[13~": KeyF1 + 2,
+	"\x1b[14~": KeyF1 + 3,
+	"\x1b[15~": KeyF1 + 4,
+	"\x1b[17~": KeyF1 + 5,
+	"\x1b[18~": KeyF1 + 6,
+	"\x1b[19~": KeyF1 + 7,
+	"\x1b[20~": KeyF1 + 8,
+	"\x1b[21~": KeyF1 + 9,
+	"\x1b[23~": KeyF1 + 10,
+	"\x1b[24~": KeyF1 + 11,
+}
+
+// DecodeKey returns HACK code of the first key in terminal input and number of bytes it takes,
+// 0 code for input without HACK key; lone escape is the Esc key
+func DecodeKey(in []byte) (int16, int) {
+	if len(in) == 0 {
+		return 0, 0
+	}
+	switch c := in[0]; {
+	case c == '\r' || c == '\n':
+		return KeyNewLine, 1
+	case c == 0x7f || c == 0x08:
+		return KeyBackSpace, 1
+	case c == 0x1b:
+		if len(in) == 1 || in[1] != '[' && in[1] != 'O' {
+			return KeyEsc, 1
+		}
+		for seq, code := range sequences {
+			if bytes.HasPrefix(in, []byte(seq)) {
+				return code, len(seq)
+			}
+		}
+		// unknown sequence, skip to its final byte
+		for i := 2; i < len(in); i++ {
+			if in[i] >= 0x40 && in[i] <= 0x7e {
+				return 0, i + 1
+			}
+		}
+		return 0, len(in)
+	case c >= ' ' && c < 0x7f:
+		return int16(c), 1
+	}
+	return 0, 1
+}
+
+// Keyboard holds the last key as pressed for a while, terminals do not report key release;
+// auto repeat of a held key keeps it pressed
+type Keyboard struct {
+	Hold time.Duration
+
+	code int16
+	at   time.Time
+}
+
+// Press records key pressed at time now
+func (k *Keyboard) Press(code int16, now time.Time) {
+	k.code = code
+	k.at = now
+}
+
+// Code returns key pressed at time now, 0 if none
+func (k *Keyboard) Code(now time.Time) int16 {
+	if now.Sub(k.at) > k.Hold {
+		return 0
+	}
+	return k.code
+}
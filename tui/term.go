@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Raw switches terminal of stdin to raw mode without echo and hides the cursor,
+// returned function restores it
+func Raw() (func(), error) {
+	saved, e := stty("-g")
+	if e != nil {
+		return nil, e
+	}
+	if _, e := stty("raw", "-echo"); e != nil {
+		return nil, e
+	}
+	os.Stdout.WriteString("\x1b[?25l\x1b[2J")
+	return func() {
+		stty(strings.TrimSpace(saved))
+		os.Stdout.WriteString("\x1b[?25h\r\n")
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, e := cmd.Output()
+	return string(out), e
+}
@@ -0,0 +1,112 @@
+// Package tui draws the HACK screen in a terminal with Unicode characters
+// and turns terminal input into HACK key codes
+package tui
+
+import (
+	"git.andmed.org/nand2tetris/screen"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode is a way to draw pixels with characters
+type Mode int
+
+// drawing modes
+const (
+	Braille   Mode = iota // 2x4 pixels per character
+	HalfBlock             // 1x2 pixels per character
+)
+
+// braille dot bits by column and row in a cell
+var brailleDots = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+// set is true if any pixel of scale x scale block at x, y is black
+func set(ram []int16, x, y, scale int) bool {
+	for j := y * scale; j < (y+1)*scale && j < screen.Height; j++ {
+		for i := x * scale; i < (x+1)*scale && i < screen.Width; i++ {
+			if ram[screen.Address+j*screen.Width/16+i/16]>>uint(i%16)&1 != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Render returns screen lines, ram is the whole computer memory,
+// scale of 2 or more draws every block of scale x scale pixels as one dot
+func Render(ram []int16, mode Mode, scale int) []string {
+	if scale < 1 {
+		scale = 1
+	}
+	w := (screen.Width + scale - 1) / scale
+	h := (screen.Height + scale - 1) / scale
+	cellW, cellH := 2, 4
+	if mode == HalfBlock {
+		cellW, cellH = 1, 2
+	}
+	var lines []string
+	var b strings.Builder
+	for y := 0; y < h; y += cellH {
+		b.Reset()
+		for x := 0; x < w; x += cellW {
+			if mode == HalfBlock {
+				b.WriteRune(halfBlock(set(ram, x, y, scale), y+1 < h && set(ram, x, y+1, scale)))
+				continue
+			}
+			r := rune(0x2800)
+			for i := 0; i < cellW && x+i < w; i++ {
+				for j := 0; j < cellH && y+j < h; j++ {
+					if set(ram, x+i, y+j, scale) {
+						r |= brailleDots[i][j]
+					}
+				}
+			}
+			b.WriteRune(r)
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+func halfBlock(top, bottom bool) rune {
+	switch {
+	case top && bottom:
+		return '█'
+	case top:
+		return '▀'
+	case bottom:
+		return '▄'
+	}
+	return ' '
+}
+
+// Layout puts panel lines to the right of screen lines and returns
+// the text to redraw terminal from its top left corner
+func Layout(screenLines, panel []string) string {
+	var width int
+	for _, s := range screenLines {
+		if n := utf8.RuneCountInString(s); n > width {
+			width = n
+		}
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i := 0; i < len(screenLines) || i < len(panel); i++ {
+		var s string
+		if i < len(screenLines) {
+			s = screenLines[i]
+		}
+		b.WriteString(s)
+		if i < len(panel) {
+			b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(s)+1))
+			b.WriteString("│ ")
+			b.WriteString(panel[i])
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+	b.WriteString("\x1b[J")
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"git.andmed.org/nand2tetris/screen"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	ram := make([]int16, screen.Address+screen.Size)
+	ram[screen.Address] = 3                      // (0, 0) and (1, 0)
+	ram[screen.Address+3*32] = 2                 // (1, 3)
+	ram[screen.Address+screen.Size-1] = -1 << 15 // (511, 255)
+
+	lines := Render(ram, Braille, 1)
+	if len(lines) != 64 || len([]rune(lines[0])) != 256 {
+		t.Fatalf("%d lines of %d", len(lines), len([]rune(lines[0])))
+	}
+	if r := []rune(lines[0])[0]; r != 0x2800|0x01|0x08|0x80 {
+		t.Errorf("braille %x", r)
+	}
+	if r := []rune(lines[63])[255]; r != 0x2800|0x80 {
+		t.Errorf("braille %x", r)
+	}
+
+	lines = Render(ram, HalfBlock, 1)
+	if len(lines) != 128 || []rune(lines[0])[0] != '▀' || []rune(lines[1])[1] != '▄' || []rune(lines[0])[2] != ' ' {
+		t.Errorf("half blocks %q %q", string([]rune(lines[0])[:3]), string([]rune(lines[1])[:3]))
+	}
+
+	lines = Render(ram, HalfBlock, 4)
+	if len(lines) != 32 || len([]rune(lines[0])) != 128 || []rune(lines[0])[0] != '▀' {
+		t.Errorf("scaled %d lines %q", len(lines), string([]rune(lines[0])[:3]))
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	for in, want := range map[string]int16{
+		"a":        'a',
+		"\r":       KeyNewLine,
+		"\x7f":     KeyBackSpace,
+		"\x1b[D":   KeyLeft,
+		"\x1b[A":   KeyUp,
+		"\x1bOC":   KeyRight,
+		"\x1b[B":   KeyDown,
+		"\x1b[H":   KeyHome,
+		"\x1b[4~":  KeyEnd,
+		"\x1b[5~":  KeyPageUp,
+		"\x1b[6~":  KeyPageDown,
+		"\x1b[2~":  KeyInsert,
+		"\x1b[3~":  KeyDelete,
+		"\x1b":     KeyEsc,
+		"\x1bOP":   141,
+		"\x1b[24~": 152,
+	} {
+		if code, n := DecodeKey([]byte(in)); code != want || n != len(in) {
+			t.Errorf("%q: %d, %d bytes", in, code, n)
+		}
+	}
+	if code, n := DecodeKey([]byte("\x1b[99;5Zx")); code != 0 || n != 7 {
+		t.Errorf("unknown sequence: %d, %d bytes", code, n)
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	now := time.Now()
+	kb := Keyboard{Hold: 100 * time.Millisecond}
+	kb.Press(KeyLeft, now)
+	if kb.Code(now.Add(50*time.Millisecond)) != KeyLeft || kb.Code(now.Add(150*time.Millisecond)) != 0 {
+		t.Error("key not held")
+	}
+}
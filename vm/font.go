@@ -0,0 +1,102 @@
+package vm
+
+// font is the bitmap font of Output.jack, 8x11 pixels per character with 6 bits used,
+// lowest bit is the leftmost pixel; index 0 is the black square drawn for codes without glyph
+var font = [127][11]int16{
+	0:    {63, 63, 63, 63, 63, 63, 63, 63, 63, 0, 0},
+	' ':  {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	'!':  {12, 30, 30, 30, 12, 12, 0, 12, 12, 0, 0},
+	'"':  {54, 54, 20, 0, 0, 0, 0, 0, 0, 0, 0},
+	'#':  {0, 18, 18, 63, 18, 18, 63, 18, 18, 0, 0},
+	'$':  {12, 30, 51, 3, 30, 48, 51, 30, 12, 12, 0},
+	'%':  {0, 0, 35, 51, 24, 12, 6, 51, 49, 0, 0},
+	'&':  {12, 30, 30, 12, 54, 27, 27, 27, 54, 0, 0},
+	'\'': {12, 12, 6, 0, 0, 0, 0, 0, 0, 0, 0},
+	'(':  {24, 12, 6, 6, 6, 6, 6, 12, 24, 0, 0},
+	')':  {6, 12, 24, 24, 24, 24, 24, 12, 6, 0, 0},
+	'*':  {0, 0, 0, 51, 30, 63, 30, 51, 0, 0, 0},
+	'+':  {0, 0, 0, 12, 12, 63, 12, 12, 0, 0, 0},
+	',':  {0, 0, 0, 0, 0, 0, 0, 12, 12, 6, 0},
+	'-':  {0, 0, 0, 0, 0, 63, 0, 0, 0, 0, 0},
+	'.':  {0, 0, 0, 0, 0, 0, 0, 12, 12, 0, 0},
+	'/':  {0, 0, 32, 48, 24, 12, 6, 3, 1, 0, 0},
+	'0':  {12, 30, 51, 51, 51, 51, 51, 30, 12, 0, 0},
+	'1':  {12, 14, 15, 12, 12, 12, 12, 12, 63, 0, 0},
+	'2':  {30, 51, 48, 24, 12, 6, 3, 51, 63, 0, 0},
+	'3':  {30, 51, 48, 48, 28, 48, 48, 51, 30, 0, 0},
+	'4':  {16, 24, 28, 26, 25, 63, 24, 24, 60, 0, 0},
+	'5':  {63, 3, 3, 31, 48, 48, 48, 51, 30, 0, 0},
+	'6':  {28, 6, 3, 3, 31, 51, 51, 51, 30, 0, 0},
+	'7':  {63, 49, 48, 48, 24, 12, 12, 12, 12, 0, 0},
+	'8':  {30, 51, 51, 51, 30, 51, 51, 51, 30, 0, 0},
+	'9':  {30, 51, 51, 51, 62, 48, 48, 24, 14, 0, 0},
+	':':  {0, 0, 12, 12, 0, 0, 12, 12, 0, 0, 0},
+	';':  {0, 0, 12, 12, 0, 0, 12, 12, 6, 0, 0},
+	'<':  {0, 0, 24, 12, 6, 3, 6, 12, 24, 0, 0},
+	'=':  {0, 0, 0, 63, 0, 0, 63, 0, 0, 0, 0},
+	'>':  {0, 0, 3, 6, 12, 24, 12, 6, 3, 0, 0},
+	'?':  {30, 51, 51, 24, 12, 12, 0, 12, 12, 0, 0},
+	'@':  {30, 51, 51, 59, 59, 59, 27, 3, 30, 0, 0},
+	'A':  {12, 30, 51, 51, 63, 51, 51, 51, 51, 0, 0},
+	'B':  {31, 51, 51, 51, 31, 51, 51, 51, 31, 0, 0},
+	'C':  {28, 54, 35, 3, 3, 3, 35, 54, 28, 0, 0},
+	'D':  {15, 27, 51, 51, 51, 51, 51, 27, 15, 0, 0},
+	'E':  {63, 51, 35, 11, 15, 11, 35, 51, 63, 0, 0},
+	'F':  {63, 51, 35, 11, 15, 11, 3, 3, 3, 0, 0},
+	'G':  {28, 54, 35, 3, 59, 51, 51, 54, 44, 0, 0},
+	'H':  {51, 51, 51, 51, 63, 51, 51, 51, 51, 0, 0},
+	'I':  {30, 12, 12, 12, 12, 12, 12, 12, 30, 0, 0},
+	'J':  {60, 24, 24, 24, 24, 24, 27, 27, 14, 0, 0},
+	'K':  {51, 51, 51, 27, 15, 27, 51, 51, 51, 0, 0},
+	'L':  {3, 3, 3, 3, 3, 3, 35, 51, 63, 0, 0},
+	'M':  {33, 51, 63, 63, 51, 51, 51, 51, 51, 0, 0},
+	'N':  {51, 51, 55, 55, 63, 59, 59, 51, 51, 0, 0},
+	'O':  {30, 51, 51, 51, 51, 51, 51, 51, 30, 0, 0},
+	'P':  {31, 51, 51, 51, 31, 3, 3, 3, 3, 0, 0},
+	'Q':  {30, 51, 51, 51, 51, 51, 63, 59, 30, 48, 0},
+	'R':  {31, 51, 51, 51, 31, 27, 51, 51, 51, 0, 0},
+	'S':  {30, 51, 51, 6, 28, 48, 51, 51, 30, 0, 0},
+	'T':  {63, 63, 45, 12, 12, 12, 12, 12, 30, 0, 0},
+	'U':  {51, 51, 51, 51, 51, 51, 51, 51, 30, 0, 0},
+	'V':  {51, 51, 51, 51, 51, 30, 30, 12, 12, 0, 0},
+	'W':  {51, 51, 51, 51, 51, 63, 63, 63, 18, 0, 0},
+	'X':  {51, 51, 30, 30, 12, 30, 30, 51, 51, 0, 0},
+	'Y':  {51, 51, 51, 51, 30, 12, 12, 12, 30, 0, 0},
+	'Z':  {63, 51, 49, 24, 12, 6, 35, 51, 63, 0, 0},
+	'[':  {30, 6, 6, 6, 6, 6, 6, 6, 30, 0, 0},
+	'\\': {0, 0, 1, 3, 6, 12, 24, 48, 32, 0, 0},
+	']':  {30, 24, 24, 24, 24, 24, 24, 24, 30, 0, 0},
+	'^':  {8, 28, 54, 0, 0, 0, 0, 0, 0, 0, 0},
+	'_':  {0, 0, 0, 0, 0, 0, 0, 0, 0, 63, 0},
+	'`':  {6, 12, 24, 0, 0, 0, 0, 0, 0, 0, 0},
+	'a':  {0, 0, 0, 14, 24, 30, 27, 27, 54, 0, 0},
+	'b':  {3, 3, 3, 15, 27, 51, 51, 51, 30, 0, 0},
+	'c':  {0, 0, 0, 30, 51, 3, 3, 51, 30, 0, 0},
+	'd':  {48, 48, 48, 60, 54, 51, 51, 51, 30, 0, 0},
+	'e':  {0, 0, 0, 30, 51, 63, 3, 51, 30, 0, 0},
+	'f':  {28, 54, 38, 6, 15, 6, 6, 6, 15, 0, 0},
+	'g':  {0, 0, 30, 51, 51, 51, 62, 48, 51, 30, 0},
+	'h':  {3, 3, 3, 27, 55, 51, 51, 51, 51, 0, 0},
+	'i':  {12, 12, 0, 14, 12, 12, 12, 12, 30, 0, 0},
+	'j':  {48, 48, 0, 56, 48, 48, 48, 48, 51, 30, 0},
+	'k':  {3, 3, 3, 51, 27, 15, 15, 27, 51, 0, 0},
+	'l':  {14, 12, 12, 12, 12, 12, 12, 12, 30, 0, 0},
+	'm':  {0, 0, 0, 29, 63, 43, 43, 43, 43, 0, 0},
+	'n':  {0, 0, 0, 29, 51, 51, 51, 51, 51, 0, 0},
+	'o':  {0, 0, 0, 30, 51, 51, 51, 51, 30, 0, 0},
+	'p':  {0, 0, 0, 30, 51, 51, 51, 31, 3, 3, 0},
+	'q':  {0, 0, 0, 30, 51, 51, 51, 62, 48, 48, 0},
+	'r':  {0, 0, 0, 29, 55, 51, 3, 3, 7, 0, 0},
+	's':  {0, 0, 0, 30, 51, 6, 24, 51, 30, 0, 0},
+	't':  {4, 6, 6, 15, 6, 6, 6, 54, 28, 0, 0},
+	'u':  {0, 0, 0, 27, 27, 27, 27, 27, 54, 0, 0},
+	'v':  {0, 0, 0, 51, 51, 51, 51, 30, 12, 0, 0},
+	'w':  {0, 0, 0, 51, 51, 51, 63, 63, 18, 0, 0},
+	'x':  {0, 0, 0, 51, 30, 12, 12, 30, 51, 0, 0},
+	'y':  {0, 0, 0, 51, 51, 51, 62, 48, 24, 15, 0},
+	'z':  {0, 0, 0, 63, 27, 12, 6, 51, 63, 0, 0},
+	'{':  {56, 12, 12, 12, 7, 12, 12, 12, 56, 0, 0},
+	'|':  {12, 12, 12, 12, 12, 12, 12, 12, 12, 0, 0},
+	'}':  {7, 12, 12, 12, 56, 12, 12, 12, 7, 0, 0},
+	'~':  {38, 45, 25, 0, 0, 0, 0, 0, 0, 0, 0},
+}
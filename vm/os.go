@@ -0,0 +1,767 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// screen geometry and text layout of Output
+const (
+	screenWidth  = 512
+	screenHeight = 256
+	rowWords     = 32
+	textRows     = 23
+	textCols     = 64
+	charHeight   = 11
+)
+
+// special characters of Jack
+const (
+	newLine     = 128
+	backSpace   = 129
+	doubleQuote = 34
+)
+
+// Sys.error codes of the standard OS
+const (
+	errWait          = 1
+	errArrayNew      = 2
+	errDivide        = 3
+	errSqrt          = 4
+	errAlloc         = 5
+	errHeap          = 6
+	errPixel         = 7
+	errLine          = 8
+	errRectangle     = 9
+	errCircleCenter  = 12
+	errCircleRadius  = 13
+	errStringNew     = 14
+	errCharAt        = 15
+	errSetCharAt     = 16
+	errAppendChar    = 17
+	errEraseLastChar = 18
+	errSetInt        = 19
+	errMoveCursor    = 20
+)
+
+// string object in heap: maximum length, length, characters
+const (
+	strMax   = 0
+	strLen   = 1
+	strChars = 2
+)
+
+// OS is Go implementation of the Jack OS classes, its functions are natives of the machine,
+// OS class loaded as VM code replaces the whole class
+type OS struct {
+	Sleep func(ms int) // Sys.wait, does nothing if nil
+
+	color    bool
+	row, col int
+	text     strings.Builder
+
+	free  []block       // free heap blocks by address
+	sizes map[int16]int // allocated blocks
+
+	key     int16   // key pressed while reading
+	reading bool    // readLine or readInt started
+	line    []int16 // characters read
+}
+
+type block struct {
+	addr, size int
+}
+
+// UseOS registers OS natives
+func (m *Machine) UseOS() *OS {
+	o := &OS{color: true}
+	o.initHeap()
+	for name, native := range map[string]Native{
+		"Math.init":            o.mathInit,
+		"Math.abs":             o.abs,
+		"Math.multiply":        o.multiply,
+		"Math.divide":          o.divide,
+		"Math.min":             o.min,
+		"Math.max":             o.max,
+		"Math.sqrt":            o.sqrt,
+		"String.new":           o.stringNew,
+		"String.dispose":       o.stringDispose,
+		"String.length":        o.length,
+		"String.charAt":        o.charAt,
+		"String.setCharAt":     o.setCharAt,
+		"String.appendChar":    o.appendChar,
+		"String.eraseLastChar": o.eraseLastChar,
+		"String.intValue":      o.intValue,
+		"String.setInt":        o.setInt,
+		"String.backSpace":     o.constant(backSpace),
+		"String.doubleQuote":   o.constant(doubleQuote),
+		"String.newLine":       o.constant(newLine),
+		"Array.new":            o.arrayNew,
+		"Array.dispose":        o.arrayDispose,
+		"Memory.init":          o.memoryInit,
+		"Memory.peek":          o.peek,
+		"Memory.poke":          o.poke,
+		"Memory.alloc":         o.alloc,
+		"Memory.deAlloc":       o.deAlloc,
+		"Output.init":          o.outputInit,
+		"Output.moveCursor":    o.moveCursor,
+		"Output.printChar":     o.printChar,
+		"Output.printString":   o.printString,
+		"Output.printInt":      o.printInt,
+		"Output.println":       o.println,
+		"Output.backSpace":     o.backSpace,
+		"Screen.init":          o.screenInit,
+		"Screen.clearScreen":   o.clearScreen,
+		"Screen.setColor":      o.setColor,
+		"Screen.drawPixel":     o.drawPixel,
+		"Screen.drawLine":      o.drawLine,
+		"Screen.drawRectangle": o.drawRectangle,
+		"Screen.drawCircle":    o.drawCircle,
+		"Keyboard.init":        o.keyboardInit,
+		"Keyboard.keyPressed":  o.keyPressed,
+		"Keyboard.readChar":    o.readChar,
+		"Keyboard.readLine":    o.readLine,
+		"Keyboard.readInt":     o.readInt,
+		"Sys.init":             o.sysInit,
+		"Sys.halt":             o.halt,
+		"Sys.error":            o.error,
+		"Sys.wait":             o.wait,
+	} {
+		m.Natives[name] = native
+	}
+	return o
+}
+
+// Text returns characters printed by Output, lines separated by newlines
+func (o *OS) Text() string {
+	return o.text.String()
+}
+
+// fail calls Sys.error, which may be VM code
+func fail(m *Machine, code int16) int16 {
+	m.Call("Sys.error", code)
+	return 0
+}
+
+func (o *OS) constant(c int16) Native {
+	return func(m *Machine, args []int16) int16 {
+		return c
+	}
+}
+
+// Sys
+
+// sysInit initializes OS classes and continues to Main.main, returning from it ends the program
+func (o *OS) sysInit(m *Machine, args []int16) int16 {
+	for _, class := range []string{"Memory", "Math", "Screen", "Output", "Keyboard"} {
+		if _, e := m.Call(class + ".init"); e != nil {
+			return 0
+		}
+	}
+	m.TailCall("Main.main")
+	return 0
+}
+
+func (o *OS) halt(m *Machine, args []int16) int16 {
+	m.Halt()
+	return 0
+}
+
+// error prints ERR<code> and stops the machine
+func (o *OS) error(m *Machine, args []int16) int16 {
+	for _, c := range "ERR" + strconv.Itoa(int(args[0])) {
+		if _, e := m.Call("Output.printChar", int16(c)); e != nil {
+			break
+		}
+	}
+	m.Fail(args[0])
+	return 0
+}
+
+func (o *OS) wait(m *Machine, args []int16) int16 {
+	if args[0] < 0 {
+		return fail(m, errWait)
+	}
+	if o.Sleep != nil {
+		o.Sleep(int(args[0]))
+	}
+	return 0
+}
+
+// Math
+
+func (o *OS) mathInit(m *Machine, args []int16) int16 {
+	return 0
+}
+
+func (o *OS) abs(m *Machine, args []int16) int16 {
+	if args[0] < 0 {
+		return -args[0]
+	}
+	return args[0]
+}
+
+func (o *OS) multiply(m *Machine, args []int16) int16 {
+	return args[0] * args[1]
+}
+
+func (o *OS) divide(m *Machine, args []int16) int16 {
+	if args[1] == 0 {
+		return fail(m, errDivide)
+	}
+	return args[0] / args[1]
+}
+
+func (o *OS) min(m *Machine, args []int16) int16 {
+	if args[0] < args[1] {
+		return args[0]
+	}
+	return args[1]
+}
+
+func (o *OS) max(m *Machine, args []int16) int16 {
+	if args[0] > args[1] {
+		return args[0]
+	}
+	return args[1]
+}
+
+func (o *OS) sqrt(m *Machine, args []int16) int16 {
+	if args[0] < 0 {
+		return fail(m, errSqrt)
+	}
+	var y int
+	for j := 7; j >= 0; j-- {
+		if t := y + 1<<uint(j); t*t <= int(args[0]) {
+			y = t
+		}
+	}
+	return int16(y)
+}
+
+// Memory, heap blocks are kept on Go side
+
+func (o *OS) initHeap() {
+	o.free = []block{{Heap, Screen - Heap}}
+	o.sizes = map[int16]int{}
+}
+
+func (o *OS) memoryInit(m *Machine, args []int16) int16 {
+	o.initHeap()
+	return 0
+}
+
+func (o *OS) peek(m *Machine, args []int16) int16 {
+	return m.RAM[int(uint16(args[0]))%RAMSize]
+}
+
+func (o *OS) poke(m *Machine, args []int16) int16 {
+	if addr := int(uint16(args[0])) % RAMSize; addr != Keyboard {
+		m.RAM[addr] = args[1]
+	}
+	return 0
+}
+
+// alloc finds first free block large enough
+func (o *OS) alloc(m *Machine, args []int16) int16 {
+	size := int(args[0])
+	if size <= 0 {
+		return fail(m, errAlloc)
+	}
+	for i, b := range o.free {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			o.free = append(o.free[:i], o.free[i+1:]...)
+		} else {
+			o.free[i] = block{b.addr + size, b.size - size}
+		}
+		o.sizes[int16(b.addr)] = size
+		return int16(b.addr)
+	}
+	return fail(m, errHeap)
+}
+
+// deAlloc returns block to the free list, merging it with its neighbours
+func (o *OS) deAlloc(m *Machine, args []int16) int16 {
+	size, ok := o.sizes[args[0]]
+	if !ok {
+		return 0
+	}
+	delete(o.sizes, args[0])
+	b := block{int(args[0]), size}
+	i := 0
+	for i < len(o.free) && o.free[i].addr < b.addr {
+		i++
+	}
+	o.free = append(o.free, block{})
+	copy(o.free[i+1:], o.free[i:])
+	o.free[i] = b
+	if i+1 < len(o.free) && b.addr+b.size == o.free[i+1].addr {
+		o.free[i].size += o.free[i+1].size
+		o.free = append(o.free[:i+1], o.free[i+2:]...)
+	}
+	if i > 0 && o.free[i-1].addr+o.free[i-1].size == b.addr {
+		o.free[i-1].size += o.free[i].size
+		o.free = append(o.free[:i], o.free[i+1:]...)
+	}
+	return 0
+}
+
+// Array
+
+func (o *OS) arrayNew(m *Machine, args []int16) int16 {
+	if args[0] <= 0 {
+		return fail(m, errArrayNew)
+	}
+	p, _ := m.Call("Memory.alloc", args[0])
+	return p
+}
+
+func (o *OS) arrayDispose(m *Machine, args []int16) int16 {
+	m.Call("Memory.deAlloc", args[0])
+	return 0
+}
+
+// String
+
+func (o *OS) stringNew(m *Machine, args []int16) int16 {
+	if args[0] < 0 {
+		return fail(m, errStringNew)
+	}
+	p, e := m.Call("Memory.alloc", args[0]+strChars)
+	if e != nil || m.Status != Running {
+		return 0
+	}
+	m.RAM[p+strMax] = args[0]
+	m.RAM[p+strLen] = 0
+	return p
+}
+
+func (o *OS) stringDispose(m *Machine, args []int16) int16 {
+	m.Call("Memory.deAlloc", args[0])
+	return 0
+}
+
+// str returns address of string field, false for strings outside of memory
+func str(m *Machine, s int16, field int) (int, bool) {
+	addr := int(s) + field
+	return addr, s >= 0 && addr < RAMSize
+}
+
+// char returns address of character i of string, false for negative i
+// and characters outside of memory
+func char(m *Machine, s int16, i int) (int, bool) {
+	addr, ok := str(m, s, strChars+i)
+	return addr, ok && i >= 0
+}
+
+func (o *OS) length(m *Machine, args []int16) int16 {
+	if addr, ok := str(m, args[0], strLen); ok {
+		return m.RAM[addr]
+	}
+	return 0
+}
+
+func (o *OS) charAt(m *Machine, args []int16) int16 {
+	s, i := args[0], args[1]
+	addr, ok := char(m, s, int(i))
+	if !ok || i >= m.RAM[s+strLen] {
+		return fail(m, errCharAt)
+	}
+	return m.RAM[addr]
+}
+
+func (o *OS) setCharAt(m *Machine, args []int16) int16 {
+	s, i := args[0], args[1]
+	addr, ok := char(m, s, int(i))
+	if !ok || i >= m.RAM[s+strLen] {
+		return fail(m, errSetCharAt)
+	}
+	m.RAM[addr] = args[2]
+	return 0
+}
+
+func (o *OS) appendChar(m *Machine, args []int16) int16 {
+	s := args[0]
+	if _, ok := str(m, s, strLen); !ok || m.RAM[s+strLen] >= m.RAM[s+strMax] {
+		return fail(m, errAppendChar)
+	}
+	addr, ok := char(m, s, int(m.RAM[s+strLen]))
+	if !ok {
+		return fail(m, errAppendChar)
+	}
+	m.RAM[addr] = args[1]
+	m.RAM[s+strLen]++
+	return s
+}
+
+func (o *OS) eraseLastChar(m *Machine, args []int16) int16 {
+	s := args[0]
+	if _, ok := str(m, s, strLen); !ok || m.RAM[s+strLen] <= 0 {
+		return fail(m, errEraseLastChar)
+	}
+	m.RAM[s+strLen]--
+	return 0
+}
+
+func (o *OS) intValue(m *Machine, args []int16) int16 {
+	s := args[0]
+	start, ok := str(m, s, strChars)
+	if !ok {
+		return 0
+	}
+	// length of a corrupted or uninitialized string is clamped to memory
+	n := int(m.RAM[s+strLen])
+	if n < 0 {
+		n = 0
+	}
+	if start+n > RAMSize {
+		n = RAMSize - start
+	}
+	return parseInt(m.RAM[start : start+n])
+}
+
+// parseInt reads optional minus and digits up to the first non digit
+func parseInt(chars []int16) int16 {
+	var v int16
+	neg := len(chars) > 0 && chars[0] == '-'
+	if neg {
+		chars = chars[1:]
+	}
+	for _, c := range chars {
+		if c < '0' || c > '9' {
+			break
+		}
+		v = v*10 + c - '0'
+	}
+	if neg {
+		return -v
+	}
+	return v
+}
+
+func (o *OS) setInt(m *Machine, args []int16) int16 {
+	s := args[0]
+	digits := strconv.Itoa(int(args[1]))
+	if _, ok := char(m, s, len(digits)-1); !ok || len(digits) > int(m.RAM[s+strMax]) {
+		return fail(m, errSetInt)
+	}
+	for i, c := range digits {
+		m.RAM[int(s)+strChars+i] = int16(c)
+	}
+	m.RAM[s+strLen] = int16(len(digits))
+	return 0
+}
+
+// Output
+
+func (o *OS) outputInit(m *Machine, args []int16) int16 {
+	o.row, o.col = 0, 0
+	return 0
+}
+
+func (o *OS) moveCursor(m *Machine, args []int16) int16 {
+	if args[0] < 0 || args[0] >= textRows || args[1] < 0 || args[1] >= textCols {
+		return fail(m, errMoveCursor)
+	}
+	o.row, o.col = int(args[0]), int(args[1])
+	return 0
+}
+
+// drawChar draws character at the cursor, two characters share a screen word
+func (o *OS) drawChar(m *Machine, c int16) {
+	glyph := font[0]
+	if ' ' <= c && c <= '~' {
+		glyph = font[c]
+	}
+	addr := Screen + o.row*charHeight*rowWords + o.col/2
+	for i, bits := range glyph {
+		word := &m.RAM[addr+i*rowWords]
+		if o.col%2 == 0 {
+			*word = *word&^0xff | bits
+		} else {
+			*word = *word&0xff | bits<<8
+		}
+	}
+}
+
+func (o *OS) printChar(m *Machine, args []int16) int16 {
+	switch c := args[0]; c {
+	case newLine:
+		o.println(m, nil)
+	case backSpace:
+		o.backSpace(m, nil)
+	default:
+		o.drawChar(m, c)
+		if ' ' <= c && c <= '~' {
+			o.text.WriteByte(byte(c))
+		}
+		o.col++
+		if o.col == textCols {
+			o.println(m, nil)
+		}
+	}
+	return 0
+}
+
+func (o *OS) printString(m *Machine, args []int16) int16 {
+	n, e := m.Call("String.length", args[0])
+	for i := int16(0); i < n && e == nil && m.Status == Running; i++ {
+		var c int16
+		if c, e = m.Call("String.charAt", args[0], i); e == nil {
+			o.printChar(m, []int16{c})
+		}
+	}
+	return 0
+}
+
+func (o *OS) printInt(m *Machine, args []int16) int16 {
+	for _, c := range strconv.Itoa(int(args[0])) {
+		o.printChar(m, []int16{int16(c)})
+	}
+	return 0
+}
+
+func (o *OS) println(m *Machine, args []int16) int16 {
+	o.text.WriteByte('\n')
+	o.col = 0
+	o.row++
+	if o.row == textRows {
+		o.row = 0
+	}
+	return 0
+}
+
+// backSpace moves cursor one column back and erases the character there
+func (o *OS) backSpace(m *Machine, args []int16) int16 {
+	switch {
+	case o.col > 0:
+		o.col--
+	case o.row > 0:
+		o.row--
+		o.col = textCols - 1
+	}
+	o.drawChar(m, ' ')
+	if s := o.text.String(); s != "" && s[len(s)-1] != '\n' {
+		o.text.Reset()
+		o.text.WriteString(s[:len(s)-1])
+	}
+	return 0
+}
+
+// Screen
+
+func (o *OS) screenInit(m *Machine, args []int16) int16 {
+	o.color = true
+	return 0
+}
+
+func (o *OS) clearScreen(m *Machine, args []int16) int16 {
+	for i := Screen; i < Screen+ScreenSize; i++ {
+		m.RAM[i] = 0
+	}
+	return 0
+}
+
+func (o *OS) setColor(m *Machine, args []int16) int16 {
+	o.color = args[0] != 0
+	return 0
+}
+
+func onScreen(x, y int) bool {
+	return 0 <= x && x < screenWidth && 0 <= y && y < screenHeight
+}
+
+func (o *OS) pixel(m *Machine, x, y int) {
+	word := &m.RAM[Screen+y*rowWords+x/16]
+	bit := int16(1) << uint(x%16)
+	if o.color {
+		*word |= bit
+	} else {
+		*word &^= bit
+	}
+}
+
+func (o *OS) drawPixel(m *Machine, args []int16) int16 {
+	x, y := int(args[0]), int(args[1])
+	if !onScreen(x, y) {
+		return fail(m, errPixel)
+	}
+	o.pixel(m, x, y)
+	return 0
+}
+
+// drawLine uses the book algorithm, walking towards the end by the sign of a*dy-b*dx
+func (o *OS) drawLine(m *Machine, args []int16) int16 {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	if !onScreen(x1, y1) || !onScreen(x2, y2) {
+		return fail(m, errLine)
+	}
+	dx, dy := abs(x2-x1), abs(y2-y1)
+	sx, sy := sign(x2-x1), sign(y2-y1)
+	var a, b, diff int
+	for a <= dx && b <= dy {
+		o.pixel(m, x1+sx*a, y1+sy*b)
+		switch {
+		case dx == 0:
+			b++
+		case dy == 0:
+			a++
+		case diff < 0:
+			a++
+			diff += dy
+		default:
+			b++
+			diff -= dx
+		}
+	}
+	return 0
+}
+
+func (o *OS) drawRectangle(m *Machine, args []int16) int16 {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	if !onScreen(x1, y1) || !onScreen(x2, y2) || x1 > x2 || y1 > y2 {
+		return fail(m, errRectangle)
+	}
+	o.fill(m, x1, x2, y1, y2)
+	return 0
+}
+
+// fill sets pixels of rectangle, whole words at once
+func (o *OS) fill(m *Machine, x1, x2, y1, y2 int) {
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; {
+			if x%16 == 0 && x+15 <= x2 {
+				word := &m.RAM[Screen+y*rowWords+x/16]
+				if o.color {
+					*word = -1
+				} else {
+					*word = 0
+				}
+				x += 16
+				continue
+			}
+			o.pixel(m, x, y)
+			x++
+		}
+	}
+}
+
+func (o *OS) drawCircle(m *Machine, args []int16) int16 {
+	x, y, r := int(args[0]), int(args[1]), int(args[2])
+	if !onScreen(x, y) {
+		return fail(m, errCircleCenter)
+	}
+	if r < 0 || r > 181 || !onScreen(x-r, y-r) || !onScreen(x+r, y+r) {
+		return fail(m, errCircleRadius)
+	}
+	for dy := -r; dy <= r; dy++ {
+		w := int(o.sqrt(m, []int16{int16(r*r - dy*dy)}))
+		o.fill(m, x-w, x+w, y+dy, y+dy)
+	}
+	return 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// Keyboard, natives waiting for a key let the program run by Retry,
+// the key is taken when it is released
+
+func (o *OS) keyboardInit(m *Machine, args []int16) int16 {
+	o.key = 0
+	o.reading = false
+	o.line = nil
+	return 0
+}
+
+func (o *OS) keyPressed(m *Machine, args []int16) int16 {
+	return m.RAM[Keyboard]
+}
+
+// typed returns key pressed and released since the last call, 0 while waiting
+func (o *OS) typed(m *Machine) int16 {
+	pressed := m.RAM[Keyboard]
+	if pressed != 0 {
+		o.key = pressed
+		return 0
+	}
+	c := o.key
+	o.key = 0
+	return c
+}
+
+func (o *OS) readChar(m *Machine, args []int16) int16 {
+	c := o.typed(m)
+	if c == 0 {
+		m.Retry()
+		return 0
+	}
+	m.Call("Output.printChar", c)
+	return c
+}
+
+// read prints message and echoes keys to the end of line, true when line is complete
+func (o *OS) read(m *Machine, message int16) bool {
+	if !o.reading {
+		o.reading = true
+		o.line = nil
+		if _, e := m.Call("Output.printString", message); e != nil {
+			return false
+		}
+	}
+	switch c := o.typed(m); c {
+	case 0:
+	case newLine:
+		o.reading = false
+		m.Call("Output.println")
+		return true
+	case backSpace:
+		if len(o.line) > 0 {
+			o.line = o.line[:len(o.line)-1]
+			m.Call("Output.backSpace")
+		}
+	default:
+		o.line = append(o.line, c)
+		m.Call("Output.printChar", c)
+	}
+	m.Retry()
+	return false
+}
+
+func (o *OS) readLine(m *Machine, args []int16) int16 {
+	if !o.read(m, args[0]) {
+		return 0
+	}
+	s, e := m.Call("String.new", int16(len(o.line)))
+	for _, c := range o.line {
+		if e != nil {
+			break
+		}
+		_, e = m.Call("String.appendChar", s, c)
+	}
+	return s
+}
+
+func (o *OS) readInt(m *Machine, args []int16) int16 {
+	if !o.read(m, args[0]) {
+		return 0
+	}
+	return parseInt(o.line)
+}
@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func runOS(t *testing.T, path string, max uint64) (*Machine, *OS) {
+	m := New()
+	os := m.UseOS()
+	if e := m.LoadPath(path); e != nil {
+		t.Fatal(e)
+	}
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Run(max); e != nil {
+		t.Fatal(e)
+	}
+	return m, os
+}
+
+func TestSeven(t *testing.T) {
+	m, os := runOS(t, "../compiler/test/Seven", 1000)
+	if m.Status != Halted || os.Text() != "7" {
+		t.Fatalf("status %d, text %q", m.Status, os.Text())
+	}
+	// top row of glyph 7 in the first character cell
+	if m.RAM[Screen] != 63 || m.RAM[Screen+rowWords] != 49 {
+		t.Fatalf("screen %d %d", m.RAM[Screen], m.RAM[Screen+rowWords])
+	}
+}
+
+func TestPong(t *testing.T) {
+	m, os := runOS(t, "../compiler/test/Pong", 10000000)
+	if m.Status != Halted {
+		t.Fatalf("status %d in %s", m.Status, m.Function())
+	}
+	if text := os.Text(); !strings.HasPrefix(text, "Score: 0") || !strings.HasSuffix(text, "Game Over") {
+		t.Fatalf("text %q", text)
+	}
+	// line under the field
+	if m.RAM[Screen+239*rowWords] != -1 {
+		t.Fatal("no line drawn")
+	}
+}
+
+func load(t *testing.T, m *Machine, name, code string) {
+	if e := m.Load(name, strings.NewReader(code)); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestOSOverride(t *testing.T) {
+	m := New()
+	m.UseOS()
+	load(t, m, "Main", `function Main.main 0
+push constant 6
+push constant 7
+call Math.multiply 2
+pop static 0
+push constant 3
+call Math.abs 1
+return`)
+	load(t, m, "Math", `function Math.multiply 0
+push constant 1
+return`)
+	if e := m.Start(); e == nil || e.Error() != "Main.vm:7: function Math.abs undefined" {
+		t.Fatal("class not replaced:", e)
+	}
+}
+
+func TestOSErrors(t *testing.T) {
+	m := New()
+	os := m.UseOS()
+	load(t, m, "Main", `function Main.main 0
+push constant 1
+push constant 0
+call Math.divide 2
+return`)
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Run(100); e != nil {
+		t.Fatal(e)
+	}
+	if m.Status != Failed || m.ErrorCode != errDivide || os.Text() != "ERR3" {
+		t.Fatalf("status %d code %d text %q", m.Status, m.ErrorCode, os.Text())
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	m := New()
+	os := m.UseOS()
+	load(t, m, "Main", `function Main.main 1
+push constant 1
+call String.new 1
+push constant 63
+call String.appendChar 2
+call Keyboard.readInt 1
+pop local 0
+push local 0
+call Output.printInt 1
+return`)
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	for _, key := range []int16{'4', '5', backSpace, '2', newLine} {
+		for _, k := range []int16{key, 0} {
+			m.RAM[Keyboard] = k
+			if _, e := m.Run(10); e != nil {
+				t.Fatal(e)
+			}
+		}
+	}
+	m.Run(100)
+	if m.Status != Halted || os.Text() != "?42\n42" {
+		t.Fatalf("status %d text %q", m.Status, os.Text())
+	}
+}
+
+func TestHeap(t *testing.T) {
+	m := New()
+	os := m.UseOS()
+	a := os.alloc(m, []int16{10})
+	b := os.alloc(m, []int16{20})
+	c := os.alloc(m, []int16{30})
+	if a != Heap || b != Heap+10 || c != Heap+30 {
+		t.Fatal(a, b, c)
+	}
+	os.deAlloc(m, []int16{a})
+	os.deAlloc(m, []int16{b})
+	if p := os.alloc(m, []int16{25}); p != Heap {
+		t.Fatal("free blocks not merged", p)
+	}
+	os.deAlloc(m, []int16{c})
+	if len(os.free) != 1 || os.free[0].addr != Heap+25 {
+		t.Fatal(os.free)
+	}
+}
+
+func TestIntValueLength(t *testing.T) {
+	m := New()
+	os := m.UseOS()
+	s := int16(RAMSize - 4)
+	m.RAM[s+strChars], m.RAM[s+strChars+1] = '4', '2'
+	for _, n := range []int16{-1, 2, 1000} {
+		m.RAM[s+strLen] = n
+		want := int16(42)
+		if n < 0 {
+			want = 0
+		}
+		if v := os.intValue(m, []int16{s}); v != want {
+			t.Errorf("length %d: %d", n, v)
+		}
+	}
+}
+
+// TestStringBounds calls String routines on corrupted strings near the end of memory
+func TestStringBounds(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ram  map[int]int16
+		call func(os *OS, m *Machine) int16
+		code int16
+	}{
+		{"appendChar", map[int]int16{30000: 6000, 30001: 5000}, func(os *OS, m *Machine) int16 { return os.appendChar(m, []int16{30000, 65}) }, errAppendChar},
+		{"appendChar negative", map[int]int16{30000: 10, 30001: -3}, func(os *OS, m *Machine) int16 { return os.appendChar(m, []int16{30000, 65}) }, errAppendChar},
+		{"setInt", map[int]int16{32765: 10}, func(os *OS, m *Machine) int16 { return os.setInt(m, []int16{32765, 12345}) }, errSetInt},
+		{"charAt", map[int]int16{32766: 5, 32767: 5}, func(os *OS, m *Machine) int16 { return os.charAt(m, []int16{32766, 0}) }, errCharAt},
+		{"setCharAt", map[int]int16{100: 5, 101: 5}, func(os *OS, m *Machine) int16 { return os.setCharAt(m, []int16{100, -1, 65}) }, errSetCharAt},
+		{"eraseLastChar", map[int]int16{}, func(os *OS, m *Machine) int16 { return os.eraseLastChar(m, []int16{32767}) }, errEraseLastChar},
+	} {
+		m := New()
+		os := m.UseOS()
+		for addr, v := range test.ram {
+			m.RAM[addr] = v
+		}
+		test.call(os, m)
+		if m.Status != Failed || m.ErrorCode != test.code {
+			t.Errorf("%s: status %d code %d", test.name, m.Status, m.ErrorCode)
+		}
+	}
+}
+
+// TestDisposeBadPointer frees pointers not given by Memory.alloc
+func TestDisposeBadPointer(t *testing.T) {
+	m := New()
+	os := m.UseOS()
+	os.initHeap()
+	for _, p := range []int16{-5, 0, 12345, Heap + 3} {
+		os.deAlloc(m, []int16{p})
+		os.arrayDispose(m, []int16{p})
+	}
+	if m.Status != Running || len(os.free) != 1 || os.free[0] != (block{Heap, Screen - Heap}) {
+		t.Fatal(m.Status, os.free)
+	}
+}
@@ -0,0 +1,566 @@
+// Package vm runs VM code directly, without translating it to assembly
+package vm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"git.andmed.org/nand2tetris/vmtranslator"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// memory map, same as the translator gives to the HACK computer
+const (
+	RAMSize    = 1 << 15
+	SP         = 0
+	LCL        = 1
+	ARG        = 2
+	THIS       = 3
+	THAT       = 4
+	Temp       = 5
+	Static     = 16
+	Stack      = 256
+	Heap       = 2048
+	Screen     = 16384
+	ScreenSize = 8192
+	Keyboard   = 24576
+)
+
+// Status of the machine
+type Status int
+
+// machine states
+const (
+	Running Status = iota
+	Halted         // Sys.halt, end of program or endless loop
+	Failed         // Sys.error
+)
+
+// Native is a function implemented in Go, gets call arguments and returns the result
+type Native func(m *Machine, args []int16) int16
+
+// Frame is a function call on the call stack
+type Frame struct {
+	Function string
+	Return   int // command to return to
+}
+
+// Command is a loaded VM command with its source position
+type Command struct {
+	vmtranslator.Command
+	File     string
+	Line     int
+	Function string // enclosing function
+	target   int    // jump target, called function or -1 for native
+	static   int    // first static address of the file
+}
+
+// Machine is VM emulator
+type Machine struct {
+	RAM       [RAMSize]int16
+	Natives   map[string]Native // used for functions not defined in VM code
+	Program   []Command
+	PC        int    // next command
+	Cycles    uint64 // commands executed
+	Frames    []Frame
+	Status    Status
+	ErrorCode int16 // argument of Sys.error
+
+	functions  map[string]int  // function name -> its command
+	classes    map[string]bool // classes with functions in VM code
+	labels     map[string]int  // function$label -> next command
+	nextStatic int
+	fault      error  // error of nested call from native
+	tail       string // function native jumps to instead of returning
+	retry      bool   // native call to be repeated on next step
+}
+
+// New returns machine without loaded code
+func New() *Machine {
+	return &Machine{
+		Natives:    map[string]Native{},
+		functions:  map[string]int{},
+		classes:    map[string]bool{},
+		labels:     map[string]int{},
+		nextStatic: Static,
+	}
+}
+
+// LoadPath loads .vm file or all .vm files of directory
+func (m *Machine) LoadPath(path string) error {
+	stat, e := os.Stat(path)
+	if e != nil {
+		return e
+	}
+	filenames := []string{path}
+	if stat.IsDir() {
+		filenames, _ = filepath.Glob(filepath.Join(path, "*.vm"))
+		if len(filenames) == 0 {
+			return fmt.Errorf("%s: no .vm files", path)
+		}
+	}
+	for _, filename := range filenames {
+		file, e := os.Open(filename)
+		if e != nil {
+			return e
+		}
+		e = m.Load(strings.TrimSuffix(filepath.Base(filename), ".vm"), file)
+		file.Close()
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Load adds VM code of one file, name is the file name without extension
+func (m *Machine) Load(name string, r io.Reader) error {
+	var fn string
+	var line, statics int
+	first := len(m.Program)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+		c, ok, e := vmtranslator.ParseLine(scanner.Text())
+		if e != nil {
+			e := e.(*vmtranslator.Error)
+			e.File, e.Line = name+".vm", line
+			return e
+		}
+		if !ok {
+			continue
+		}
+		switch c.Type {
+		case vmtranslator.CmdFunction:
+			fn = c.Arg1
+			if _, ok := m.functions[fn]; ok {
+				return fmt.Errorf("%s.vm:%d: function %s redefined", name, line, fn)
+			}
+			m.functions[fn] = len(m.Program)
+			m.classes[class(fn)] = true
+		case vmtranslator.CmdLabel:
+			m.labels[fn+"$"+c.Arg1] = len(m.Program)
+			continue
+		case vmtranslator.CmdPush, vmtranslator.CmdPop:
+			if c.Arg1 == "static" && c.Arg2 >= statics {
+				statics = c.Arg2 + 1
+			}
+		}
+		m.Program = append(m.Program, Command{
+			Command:  c,
+			File:     name + ".vm",
+			Line:     line,
+			Function: fn,
+		})
+	}
+	for i := first; i < len(m.Program); i++ {
+		m.Program[i].static = m.nextStatic
+	}
+	m.nextStatic += statics
+	return scanner.Err()
+}
+
+// Start resolves jumps and calls of loaded code and starts the program
+// by calling Sys.init as translator bootstrap does, or from the first command if there is no Sys.init
+func (m *Machine) Start() error {
+	var missing []string
+	undefined := map[string]bool{}
+	for i := range m.Program {
+		c := &m.Program[i]
+		switch c.Type {
+		case vmtranslator.CmdGoto, vmtranslator.CmdIf:
+			target, ok := m.labels[c.Function+"$"+c.Arg1]
+			if !ok {
+				missing = append(missing, fmt.Sprintf("%s:%d: label %s not found in %s", c.File, c.Line, c.Arg1, c.Function))
+			}
+			c.target = target
+		case vmtranslator.CmdCall:
+			target, ok := m.functions[c.Arg1]
+			if !ok {
+				target = -1
+				if m.native(c.Arg1) == nil && !undefined[c.Arg1] {
+					undefined[c.Arg1] = true
+					missing = append(missing, fmt.Sprintf("%s:%d: function %s undefined", c.File, c.Line, c.Arg1))
+				}
+			}
+			c.target = target
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.New(strings.Join(missing, "\n"))
+	}
+	if len(m.Program) > math.MaxInt16 {
+		// return addresses are kept in 16 bit RAM
+		return fmt.Errorf("program of %d commands, at most %d can run", len(m.Program), math.MaxInt16)
+	}
+
+	m.RAM[SP] = Stack
+	m.PC = 0
+	m.Cycles = 0
+	m.Frames = nil
+	m.Status = Running
+	m.ErrorCode = 0
+	if _, ok := m.functions["Sys.init"]; ok || m.native("Sys.init") != nil {
+		return m.call("Sys.init", 0, len(m.Program))
+	}
+	return nil
+}
+
+// native returns Go implementation of function, natives of a class are
+// not used if any function of the class is defined in VM code
+func (m *Machine) native(fn string) Native {
+	if m.classes[class(fn)] {
+		return nil
+	}
+	return m.Natives[fn]
+}
+
+func class(fn string) string {
+	if i := strings.Index(fn, "."); i >= 0 {
+		return fn[:i]
+	}
+	return fn
+}
+
+// Call runs function to its return and gives its result, used by natives to call other functions;
+// nothing is done after the machine stopped
+func (m *Machine) Call(fn string, args ...int16) (int16, error) {
+	if m.fault != nil || m.Status != Running {
+		return 0, m.fault
+	}
+	pc := m.PC
+	depth := len(m.Frames)
+	if native := m.native(fn); native != nil {
+		return native(m, args), m.fault
+	}
+	for _, v := range args {
+		if e := m.push(v); e != nil {
+			m.fault = e
+			return 0, e
+		}
+	}
+	if e := m.call(fn, len(args), pc); e != nil {
+		m.fault = e
+		return 0, e
+	}
+	for len(m.Frames) > depth && m.Status == Running {
+		if m.PC >= len(m.Program) {
+			m.Status = Halted
+			break
+		}
+		c := &m.Program[m.PC]
+		if e := m.exec(c); e != nil {
+			m.fault = fmt.Errorf("%s:%d: %s", c.File, c.Line, e)
+			return 0, m.fault
+		}
+		m.Cycles++
+	}
+	if m.Status != Running {
+		return 0, nil
+	}
+	v, e := m.pop()
+	m.fault = e
+	return v, e
+}
+
+// TailCall makes native continue to function fn without arguments instead of returning
+func (m *Machine) TailCall(fn string) {
+	m.tail = fn
+}
+
+// Retry makes native be called again with the same arguments on the next step,
+// natives waiting for input use it to let the program run
+func (m *Machine) Retry() {
+	m.retry = true
+}
+
+// Halt stops the machine, used by natives
+func (m *Machine) Halt() {
+	m.Status = Halted
+}
+
+// Fail stops the machine with error code, used by natives
+func (m *Machine) Fail(code int16) {
+	m.Status = Failed
+	m.ErrorCode = code
+}
+
+// Run executes up to max commands while machine is running, returns number of commands executed
+func (m *Machine) Run(max uint64) (uint64, error) {
+	var n uint64
+	for ; n < max && m.Status == Running; n++ {
+		if e := m.Step(); e != nil {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// Function returns name of the function being executed
+func (m *Machine) Function() string {
+	if len(m.Frames) > 0 {
+		return m.Frames[len(m.Frames)-1].Function
+	}
+	if m.PC < len(m.Program) {
+		return m.Program[m.PC].Function
+	}
+	return ""
+}
+
+// StaticBase returns RAM address of static 0 of the file containing command pc
+func (m *Machine) StaticBase(pc int) int {
+	return m.Program[pc].static
+}
+
+// Step executes one command
+func (m *Machine) Step() error {
+	if m.Status != Running {
+		return nil
+	}
+	if m.PC >= len(m.Program) {
+		m.Status = Halted
+		return nil
+	}
+	c := &m.Program[m.PC]
+	e := m.exec(c)
+	if e != nil {
+		return fmt.Errorf("%s:%d: %s", c.File, c.Line, e)
+	}
+	m.Cycles++
+	return nil
+}
+
+func (m *Machine) exec(c *Command) error {
+	switch c.Type {
+	case vmtranslator.CmdPush:
+		var v int16
+		if c.Arg1 == "constant" {
+			v = int16(c.Arg2)
+		} else {
+			addr, e := m.address(c)
+			if e != nil {
+				return e
+			}
+			v = m.RAM[addr]
+		}
+		if e := m.push(v); e != nil {
+			return e
+		}
+	case vmtranslator.CmdPop:
+		addr, e := m.address(c)
+		if e != nil {
+			return e
+		}
+		v, e := m.pop()
+		if e != nil {
+			return e
+		}
+		m.RAM[addr] = v
+	case vmtranslator.CmdArithmetic:
+		if e := m.arithmetic(c.Arg1); e != nil {
+			return e
+		}
+	case vmtranslator.CmdGoto:
+		if c.target == m.PC {
+			m.Status = Halted
+			return nil
+		}
+		m.PC = c.target
+		return nil
+	case vmtranslator.CmdIf:
+		v, e := m.pop()
+		if e != nil {
+			return e
+		}
+		if v != 0 {
+			m.PC = c.target
+			return nil
+		}
+	case vmtranslator.CmdFunction:
+		for i := 0; i < c.Arg2; i++ {
+			if e := m.push(0); e != nil {
+				return e
+			}
+		}
+	case vmtranslator.CmdCall:
+		return m.call(c.Arg1, c.Arg2, m.PC+1)
+	case vmtranslator.CmdReturn:
+		return m.ret()
+	}
+	m.PC++
+	return nil
+}
+
+// address of segment element
+func (m *Machine) address(c *Command) (int, error) {
+	var addr int
+	switch c.Arg1 {
+	case "local":
+		addr = int(m.RAM[LCL]) + c.Arg2
+	case "argument":
+		addr = int(m.RAM[ARG]) + c.Arg2
+	case "this":
+		addr = int(m.RAM[THIS]) + c.Arg2
+	case "that":
+		addr = int(m.RAM[THAT]) + c.Arg2
+	case "temp":
+		addr = Temp + c.Arg2
+	case "pointer":
+		addr = THIS + c.Arg2
+	case "static":
+		addr = c.static + c.Arg2
+	default:
+		return 0, fmt.Errorf("wrong memory region %s", c.Arg1)
+	}
+	if addr < 0 || addr >= RAMSize {
+		return 0, fmt.Errorf("%s %d out of memory at %d", c.Arg1, c.Arg2, addr)
+	}
+	return addr, nil
+}
+
+func (m *Machine) push(v int16) error {
+	sp := int(m.RAM[SP])
+	if sp < 0 || sp >= RAMSize {
+		return fmt.Errorf("stack pointer out of memory at %d", sp)
+	}
+	m.RAM[sp] = v
+	m.RAM[SP]++
+	return nil
+}
+
+func (m *Machine) pop() (int16, error) {
+	sp := int(m.RAM[SP]) - 1
+	if sp < 0 || sp >= RAMSize {
+		return 0, fmt.Errorf("stack pointer out of memory at %d", sp)
+	}
+	m.RAM[SP]--
+	return m.RAM[sp], nil
+}
+
+func (m *Machine) arithmetic(op string) error {
+	y, e := m.pop()
+	if e != nil {
+		return e
+	}
+	switch op {
+	case "neg":
+		return m.push(-y)
+	case "not":
+		return m.push(^y)
+	}
+	x, e := m.pop()
+	if e != nil {
+		return e
+	}
+	var v int16
+	switch op {
+	case "add":
+		v = x + y
+	case "sub":
+		v = x - y
+	case "and":
+		v = x & y
+	case "or":
+		v = x | y
+	case "eq":
+		v = truth(x == y)
+	case "gt":
+		v = truth(x > y)
+	case "lt":
+		v = truth(x < y)
+	default:
+		return fmt.Errorf("unknown operation %s", op)
+	}
+	return m.push(v)
+}
+
+func truth(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// call saves the caller frame in memory as translator does and jumps to the function,
+// natives get arguments from stack and push their result
+func (m *Machine) call(fn string, argsN int, ret int) error {
+	target, ok := m.functions[fn]
+	if !ok {
+		native := m.native(fn)
+		if native == nil {
+			return fmt.Errorf("function %s undefined", fn)
+		}
+		sp := int(m.RAM[SP])
+		if sp-argsN < 0 || sp > RAMSize {
+			return fmt.Errorf("%s: not enough arguments on stack", fn)
+		}
+		args := make([]int16, argsN)
+		copy(args, m.RAM[sp-argsN:sp])
+		m.RAM[SP] -= int16(argsN)
+		v := native(m, args)
+		if e := m.fault; e != nil {
+			m.fault = nil
+			return e
+		}
+		if m.retry {
+			m.retry = false
+			m.RAM[SP] += int16(argsN)
+			return nil
+		}
+		m.PC = ret
+		if m.Status != Running {
+			return nil
+		}
+		if m.tail != "" {
+			fn, m.tail = m.tail, ""
+			return m.call(fn, 0, ret)
+		}
+		return m.push(v)
+	}
+	for _, v := range []int16{int16(ret), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if e := m.push(v); e != nil {
+			return e
+		}
+	}
+	m.RAM[ARG] = m.RAM[SP] - int16(argsN) - 5
+	m.RAM[LCL] = m.RAM[SP]
+	m.Frames = append(m.Frames, Frame{Function: fn, Return: ret})
+	m.PC = target
+	return nil
+}
+
+func (m *Machine) ret() error {
+	frame := int(m.RAM[LCL])
+	if frame < 5 || frame >= RAMSize {
+		return fmt.Errorf("bad frame at %d", frame)
+	}
+	ret := int(m.RAM[frame-5])
+	if ret < 0 || ret > len(m.Program) {
+		return fmt.Errorf("bad return address %d", ret)
+	}
+	v, e := m.pop()
+	if e != nil {
+		return e
+	}
+	arg := int(m.RAM[ARG])
+	if arg < 0 || arg >= RAMSize {
+		return fmt.Errorf("bad argument pointer %d", arg)
+	}
+	m.RAM[arg] = v
+	m.RAM[SP] = int16(arg + 1)
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+	if len(m.Frames) > 0 {
+		m.Frames = m.Frames[:len(m.Frames)-1]
+	}
+	m.PC = ret
+	return nil
+}
@@ -0,0 +1,137 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func start(t *testing.T, m *Machine) {
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Run(100000); e != nil {
+		t.Fatal(e)
+	}
+	if m.Status != Halted {
+		t.Fatal("not halted")
+	}
+}
+
+func TestFibonacciElement(t *testing.T) {
+	m := New()
+	if e := m.LoadPath("../testdata/FunctionCalls/FibonacciElement"); e != nil {
+		t.Fatal(e)
+	}
+	start(t, m)
+	if m.RAM[SP] != 262 || m.RAM[261] != 3 {
+		t.Fatalf("SP=%d RAM[261]=%d", m.RAM[SP], m.RAM[261])
+	}
+	if m.Function() != "Sys.init" {
+		t.Fatalf("halted in %s", m.Function())
+	}
+}
+
+func TestStatics(t *testing.T) {
+	m := New()
+	if e := m.LoadPath("../testdata/FunctionCalls/StaticsTest"); e != nil {
+		t.Fatal(e)
+	}
+	start(t, m)
+	if m.RAM[SP] != 263 || m.RAM[261] != -2 || m.RAM[262] != 8 {
+		t.Fatalf("SP=%d RAM[261]=%d RAM[262]=%d", m.RAM[SP], m.RAM[261], m.RAM[262])
+	}
+	if m.RAM[Static] != 6 || m.RAM[Static+2] != 23 {
+		t.Fatal("statics not allocated per file")
+	}
+}
+
+func TestNatives(t *testing.T) {
+	m := New()
+	m.Natives["Math.multiply"] = func(m *Machine, args []int16) int16 {
+		return args[0] * args[1]
+	}
+	m.Natives["Sys.halt"] = func(m *Machine, args []int16) int16 {
+		m.Halt()
+		return 0
+	}
+	e := m.Load("Main", strings.NewReader(`function Main.main 1
+push constant 6
+push constant 7
+call Math.multiply 2
+pop local 0
+label LOOP  // labels are local to functions
+push local 0
+push constant 1
+sub
+pop local 0
+push local 0
+push constant 40
+gt
+if-goto LOOP
+push local 0
+pop static 0
+call Sys.halt 0
+function Main.other 0
+label LOOP
+goto LOOP`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	start(t, m)
+	if m.RAM[Static] != 40 {
+		t.Fatalf("static 0 = %d", m.RAM[Static])
+	}
+	if m.Cycles != 24 {
+		t.Fatalf("%d cycles", m.Cycles)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	m := New()
+	if e := m.Load("Main", strings.NewReader("function Main.main 0\npush constant")); e == nil || e.Error() != "Main.vm:2:14: push expects 2 arguments" {
+		t.Fatalf("got %v", e)
+	}
+	m = New()
+	m.Load("Main", strings.NewReader("function Main.main 0\ngoto END\nfunction Main.f 0\nlabel END"))
+	if e := m.Start(); e == nil || e.Error() != "Main.vm:2: label END not found in Main.main" {
+		t.Fatalf("got %v", e)
+	}
+	m = New()
+	m.Load("Main", strings.NewReader("function Main.main 0\npush constant 1\nneg\npop pointer 0\npush constant 1\npop this 0"))
+	m.Start()
+	if _, e := m.Run(10); e == nil || e.Error() != "Main.vm:6: this 0 out of memory at -1" {
+		t.Fatalf("got %v", e)
+	}
+}
+
+func TestBadReturn(t *testing.T) {
+	m := New()
+	src := "function Sys.init 0\ncall Main.f 0\nfunction Main.f 0\npush constant 1\nneg\npop argument 0\npush constant 0\nreturn"
+	m.Load("Sys", strings.NewReader(src))
+	if e := m.Start(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Run(10); e == nil || e.Error() != "Sys.vm:8: bad return address -1" {
+		t.Fatalf("got %v", e)
+	}
+
+	m = New()
+	m.Load("Main", strings.NewReader("function Main.main 0\n"+strings.Repeat("push constant 0\n", 32767)))
+	if e := m.Start(); e == nil || e.Error() != "program of 32768 commands, at most 32767 can run" {
+		t.Fatalf("got %v", e)
+	}
+}
+
+func TestPongLinks(t *testing.T) {
+	m := New()
+	if e := m.LoadPath("../compiler/test/Pong"); e != nil {
+		t.Fatal(e)
+	}
+	e := m.Start()
+	if e == nil || !strings.Contains(e.Error(), "function Screen.drawRectangle undefined") {
+		t.Fatalf("OS functions resolved: %v", e)
+	}
+	if strings.Contains(e.Error(), "label") || strings.Contains(e.Error(), "function PongGame.") {
+		t.Fatalf("program not linked: %v", e)
+	}
+}
@@ -0,0 +1,109 @@
+package vmtranslator
+
+// Routines adds shared call, return and comparison routines of compact mode
+// once, Bootstrap adds them after jumping to Sys.init; without bootstrap they
+// have to be added after translated code
+func Routines(b *VMTranslator) {
+	if !b.Compact || b.routines {
+		return
+	}
+	b.routines = true
+	b.chunks = append(b.chunks, chunk{"", "", b.Len()})
+	b.mapped = append(b.mapped, mapping{Position{}, b.Len()})
+	if comments {
+		b.c("// call routine: R13 function, R14 n of args, R15 return address")
+	}
+	b.l("$CALL")
+	b.a(15)
+	b.c("D=M")
+	b.pushD()
+	for _, p := range []string{local, argument, this, that} {
+		b.a(p)
+		b.c("D=M")
+		b.pushD()
+	}
+	// ARG = sp - (n of args) - 5
+	b.a(sp)
+	b.c("D=M")
+	b.a(5)
+	b.c("D=D-A")
+	b.a(14)
+	b.c("D=D-M")
+	b.a(argument)
+	b.c("M=D")
+	// LCL = sp
+	b.a(sp)
+	b.c("D=M")
+	b.a(local)
+	b.c("M=D")
+	b.a(13)
+	b.c("A=M")
+	b.c("0;JMP")
+
+	if comments {
+		b.c("// return routine")
+	}
+	b.l("$RETURN")
+	b.ret()
+
+	for _, cmp := range []struct{ name, jump string }{{"$EQ", "JEQ"}, {"$GT", "JGT"}, {"$LT", "JLT"}} {
+		if comments {
+			b.c("// comparison routine: R15 return address")
+		}
+		b.l(cmp.name)
+		// x - y, replace x with true
+		b.a(sp)
+		b.c("AM=M-1")
+		b.c("D=M")
+		b.c("A=A-1")
+		b.c("D=M-D")
+		b.c("M=-1")
+		b.a(cmp.name + "$TRUE")
+		b.c("D;" + cmp.jump)
+		b.a(sp)
+		b.c("A=M-1")
+		b.c("M=0")
+		b.l(cmp.name + "$TRUE")
+		b.a(15)
+		b.c("A=M")
+		b.c("0;JMP")
+	}
+}
+
+// compact generates call, return and comparisons calling routines, false for other commands
+func compact(b *VMTranslator, c Command) bool {
+	switch {
+	case c.Type == CmdCall:
+		label, _ := b.l()
+		b.a(label)
+		b.c("D=A")
+		b.a(15)
+		b.c("M=D")
+		b.a(c.Arg2)
+		b.c("D=A")
+		b.a(14)
+		b.c("M=D")
+		b.a(c.Arg1)
+		b.c("D=A")
+		b.a(13)
+		b.c("M=D")
+		b.a("$CALL")
+		b.c("0;JMP")
+		b.l(label)
+	case c.Type == CmdReturn:
+		b.a("$RETURN")
+		b.c("0;JMP")
+	case c.Type == CmdArithmetic && (c.Arg1 == "eq" || c.Arg1 == "gt" || c.Arg1 == "lt"):
+		label, _ := b.l()
+		b.a(label)
+		b.c("D=A")
+		b.a(15)
+		b.c("M=D")
+		b.c("@$%s", map[string]string{"eq": "EQ", "gt": "GT", "lt": "LT"}[c.Arg1])
+		b.c("0;JMP")
+		b.l(label)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package vmtranslator
+
+import (
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/cpu"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// conformance runs the FunctionCalls programs of the course on the CPU emulator
+// and checks RAM as their .cmp files do
+var conformance = []struct {
+	dir       string
+	bootstrap bool
+	cycles    uint64
+	ram       map[int]int16 // set before the run
+	want      map[int]int16
+}{
+	{
+		dir:    "SimpleFunction",
+		cycles: 300,
+		ram: map[int]int16{0: 317, 1: 317, 2: 310, 3: 3000, 4: 4000,
+			310: 1234, 311: 37, 312: 1000, 313: 305, 314: 300, 315: 3010, 316: 4010},
+		want: map[int]int16{0: 311, 1: 305, 2: 300, 3: 3010, 4: 4010, 310: 1196},
+	},
+	{
+		dir:    "NestedCall",
+		cycles: 4000,
+		ram:    nestedCallRAM(),
+		want:   map[int]int16{0: 261, 1: 261, 2: 256, 3: 4000, 4: 5000, 5: 135, 6: 246},
+	},
+	{
+		dir:       "FibonacciElement",
+		bootstrap: true,
+		cycles:    6000,
+		want:      map[int]int16{0: 262, 261: 3},
+	},
+	{
+		dir:       "StaticsTest",
+		bootstrap: true,
+		cycles:    2500,
+		want:      map[int]int16{0: 263, 261: -2, 262: 8},
+	},
+}
+
+// nestedCallRAM is NestedCall.tst setup: a frame as if bootstrap called Sys.init,
+// the rest of the stack set to -1 to check that locals are zeroed
+func nestedCallRAM() map[int]int16 {
+	ram := map[int]int16{0: 261, 1: 261, 2: 256, 3: -3, 4: -4, 5: -1, 6: -1,
+		256: 1234, 257: -1, 258: -2, 259: -3, 260: -4}
+	for addr := 261; addr < 300; addr++ {
+		ram[addr] = -1
+	}
+	return ram
+}
+
+func TestConformance(t *testing.T) {
+	for _, mode := range modes {
+		for _, test := range conformance {
+			c, _ := run(t, test.dir, test.bootstrap, mode, test.ram, test.cycles)
+			for addr, v := range test.want {
+				if c.RAM[addr] != v {
+					t.Errorf("%s %+v: RAM[%d] = %d, want %d", test.dir, mode, addr, c.RAM[addr], v)
+				}
+			}
+		}
+	}
+}
+
+// mode is code generation mode
+type mode struct {
+	compact, optimize bool
+}
+
+var modes = []mode{{false, false}, {true, false}, {false, true}, {true, true}}
+
+// run translates and runs VM files of testdata dir for up to cycles instructions
+func run(t *testing.T, dir string, bootstrap bool, mode mode, ram map[int]int16, cycles uint64) (*cpu.Computer, *VMTranslator) {
+	b := VMTranslator{Compact: mode.compact}
+	if bootstrap {
+		Bootstrap(&b)
+	}
+	filenames, _ := filepath.Glob(filepath.Join("../testdata/FunctionCalls", dir, "*.vm"))
+	if len(filenames) == 0 {
+		t.Fatalf("%s: no .vm files", dir)
+	}
+	for _, filename := range filenames {
+		if _, ok := TranslateFile(&b, filename); !ok {
+			t.Fatalf("%s: translation failed", filename)
+		}
+	}
+	Routines(&b)
+	if mode.optimize {
+		b.Optimize()
+	}
+	var c cpu.Computer
+	if _, e := c.LoadAsm(strings.NewReader(b.String())); e != nil {
+		t.Fatalf("%s: %s", dir, e)
+	}
+	for addr, v := range ram {
+		c.RAM[addr] = v
+	}
+	c.Run(cycles)
+	return &c, &b
+}
+
+// TestCompact measures ROM words and cycles of compact mode against inline mode
+func TestCompact(t *testing.T) {
+	for _, test := range conformance {
+		if !test.bootstrap {
+			continue
+		}
+		var words [2]int
+		var cycles [2]uint64
+		for i, compact := range []bool{false, true} {
+			c, b := run(t, test.dir, true, mode{compact: compact}, nil, test.cycles)
+			if !c.Halted() {
+				t.Fatalf("%s compact %t: not halted", test.dir, compact)
+			}
+			words[i] = assembler.Total(b.Sizes())
+			cycles[i] = c.Cycles
+		}
+		t.Logf("%s: %d -> %d ROM words, %d -> %d cycles", test.dir, words[0], words[1], cycles[0], cycles[1])
+		if words[1] >= words[0] {
+			t.Errorf("%s: compact takes %d ROM words, inline %d", test.dir, words[1], words[0])
+		}
+	}
+}
+
+// TestOptimize runs programs with and without peephole optimization and compares
+// the stack and statics after they halt; R13-R15 keep translator addresses
+func TestOptimize(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		for _, test := range conformance {
+			if !test.bootstrap {
+				continue
+			}
+			plain, b := run(t, test.dir, true, mode{compact, false}, nil, test.cycles)
+			optimized, o := run(t, test.dir, true, mode{compact, true}, nil, test.cycles)
+			if !plain.Halted() || !optimized.Halted() {
+				t.Fatalf("%s compact %t: not halted", test.dir, compact)
+			}
+			for addr := 0; addr < int(plain.RAM[0]); addr++ {
+				if (addr < 13 || addr > 15) && plain.RAM[addr] != optimized.RAM[addr] {
+					t.Errorf("%s compact %t: RAM[%d] = %d, want %d", test.dir, compact, addr, optimized.RAM[addr], plain.RAM[addr])
+				}
+			}
+			words, optimizedWords := assembler.Total(b.Sizes()), assembler.Total(o.Sizes())
+			t.Logf("%s compact %t: %d -> %d ROM words, %d -> %d cycles", test.dir, compact, words, optimizedWords, plain.Cycles, optimized.Cycles)
+			if optimizedWords >= words || optimized.Cycles >= plain.Cycles {
+				t.Errorf("%s compact %t: not optimized", test.dir, compact)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package vmtranslator
+
+import (
+	"git.andmed.org/nand2tetris/assembler"
+	"sort"
+	"strings"
+)
+
+// chunk is where assembly of a function starts in output, up to the next chunk;
+// name is empty for code outside functions
+type chunk struct {
+	name  string
+	file  string
+	start int
+}
+
+// mapping is where assembly of a VM command starts in output, empty position
+// for code not translated from VM (routines)
+type mapping struct {
+	pos   Position
+	start int
+}
+
+// Address is ROM address of the first instruction of a VM command, commands
+// without instructions (labels) share the address of the next one
+type Address struct {
+	Position
+	Addr int
+}
+
+// Eliminate removes functions not reachable by calls from Sys.init, or from the first
+// function without bootstrap, and from keep; returns removed functions, sorted,
+// and ROM words saved
+func (b *VMTranslator) Eliminate(keep ...string) ([]string, int) {
+	parts := b.parts()
+
+	roots := append([]string{"Sys.init"}, keep...)
+	if !b.bootstrap {
+		for _, c := range b.chunks {
+			if c.name != "" {
+				roots = append(roots, c.name)
+				break
+			}
+		}
+	}
+	graph := map[string][]string{}
+	for _, c := range b.calls {
+		graph[c.from] = append(graph[c.from], c.target)
+	}
+	live := map[string]bool{}
+	var visit func(fn string)
+	visit = func(fn string) {
+		if live[fn] {
+			return
+		}
+		live[fn] = true
+		for _, target := range graph[fn] {
+			visit(target)
+		}
+	}
+	for _, fn := range roots {
+		visit(fn)
+	}
+
+	var out strings.Builder
+	var chunks []chunk
+	var mapped []mapping
+	dead := map[string]bool{}
+	var saved, start int // start of part in old output
+	for _, p := range parts {
+		end := start + len(p.code)
+		keep := p.name == "" || live[p.name]
+		for ; len(b.mapped) > 0 && b.mapped[0].start < end; b.mapped = b.mapped[1:] {
+			if keep {
+				mapped = append(mapped, mapping{b.mapped[0].pos, b.mapped[0].start - start + out.Len()})
+			}
+		}
+		start = end
+		if !keep {
+			dead[p.name] = true
+			saved += instructions(p.code)
+			continue
+		}
+		chunks = append(chunks, chunk{p.name, p.file, out.Len()})
+		out.WriteString(p.code)
+	}
+	var removed []string
+	for fn := range dead {
+		removed = append(removed, fn)
+		delete(b.defs, fn)
+		delete(b.args, fn)
+	}
+	sort.Strings(removed)
+	var calls []call
+	for _, c := range b.calls {
+		if !dead[c.from] {
+			calls = append(calls, c)
+		}
+	}
+	for _, m := range b.mapped {
+		// commands without instructions at the end
+		mapped = append(mapped, mapping{m.pos, out.Len()})
+	}
+	b.calls, b.chunks, b.mapped = calls, chunks, mapped
+	b.Reset()
+	b.WriteString(out.String())
+	return removed, saved
+}
+
+// part is assembly of a chunk
+type part struct {
+	name, file, code string
+}
+
+// parts splits output by chunks, code before the first chunk is bootstrap
+func (b *VMTranslator) parts() []part {
+	code := b.String()
+	var parts []part
+	if len(b.chunks) == 0 || b.chunks[0].start > 0 {
+		end := len(code)
+		if len(b.chunks) > 0 {
+			end = b.chunks[0].start
+		}
+		parts = append(parts, part{"", "", code[:end]})
+	}
+	for i, c := range b.chunks {
+		end := len(code)
+		if i+1 < len(b.chunks) {
+			end = b.chunks[i+1].start
+		}
+		parts = append(parts, part{c.name, c.file, code[c.start:end]})
+	}
+	return parts
+}
+
+// Sizes estimates ROM words of translated functions by counting instructions, largest first;
+// code outside functions is named "(bootstrap)" or "(File.vm)"
+func (b *VMTranslator) Sizes() []assembler.Size {
+	words := map[[2]string]int{}
+	for _, p := range b.parts() {
+		name := p.name
+		if name == "" {
+			name = "(bootstrap)"
+			if p.file != "" {
+				name = "(" + p.file + ")"
+			}
+		}
+		words[[2]string{name, p.file}] += instructions(p.code)
+	}
+	var sizes []assembler.Size
+	for key, n := range words {
+		if n > 0 {
+			sizes = append(sizes, assembler.Size{Name: key[0], File: key[1], Words: n})
+		}
+	}
+	assembler.SortSizes(sizes)
+	return sizes
+}
+
+// Addresses returns ROM addresses of translated VM commands in output order;
+// Eliminate keeps them, Optimize drops them as it merges code of neighbouring commands
+func (b *VMTranslator) Addresses() []Address {
+	code := b.String()
+	var addrs []Address
+	var addr, prev int
+	for _, m := range b.mapped {
+		addr += instructions(code[prev:m.start])
+		prev = m.start
+		addrs = append(addrs, Address{m.pos, addr})
+	}
+	return addrs
+}
+
+// instructions counts A and C instructions of assembly
+func instructions(asm string) int {
+	var n int
+	for _, s := range strings.Split(asm, "\n") {
+		s = strings.TrimSpace(s)
+		if s != "" && !strings.HasPrefix(s, "//") && !strings.HasPrefix(s, "(") {
+			n++
+		}
+	}
+	return n
+}
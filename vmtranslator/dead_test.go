@@ -0,0 +1,119 @@
+package vmtranslator
+
+import (
+	"git.andmed.org/nand2tetris/assembler"
+	"git.andmed.org/nand2tetris/cpu"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEliminate(t *testing.T) {
+	var b VMTranslator
+	Bootstrap(&b)
+	filenames, _ := filepath.Glob("../testdata/FunctionCalls/FibonacciElement/*.vm")
+	for _, filename := range filenames {
+		TranslateFile(&b, filename)
+	}
+	unused := `function Util.a 0
+call Util.b 0
+return
+function Util.b 0
+push constant 1
+return
+function Util.c 0
+call Util.a 0
+return`
+	Translate(&b, "Util", strings.NewReader(unused))
+	var before assembler.Assembler
+	if e := before.Parse(strings.NewReader(b.String())); e != nil {
+		t.Fatal(e)
+	}
+
+	removed, saved := b.Eliminate("Util.b")
+	if !reflect.DeepEqual(removed, []string{"Util.a", "Util.c"}) {
+		t.Errorf("removed %v", removed)
+	}
+	var c cpu.Computer
+	syms, e := c.LoadAsm(strings.NewReader(b.String()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var after assembler.Assembler
+	after.Parse(strings.NewReader(b.String()))
+	if saved != len(before.Code)-len(after.Code) || saved == 0 {
+		t.Errorf("saved %d of %d words, now %d", saved, len(before.Code), len(after.Code))
+	}
+	if _, ok := syms.Labels["Util.b"]; !ok {
+		t.Error("kept function removed")
+	}
+	c.Run(6000)
+	if c.RAM[0] != 262 || c.RAM[261] != 3 {
+		t.Errorf("RAM[0] = %d, RAM[261] = %d", c.RAM[0], c.RAM[261])
+	}
+	if errs := b.Check(); len(errs) != 0 {
+		t.Errorf("%v", errs)
+	}
+}
+
+func TestSizes(t *testing.T) {
+	var b VMTranslator
+	Bootstrap(&b)
+	filenames, _ := filepath.Glob("../testdata/FunctionCalls/FibonacciElement/*.vm")
+	for _, filename := range filenames {
+		TranslateFile(&b, filename)
+	}
+	var a assembler.Assembler
+	if e := a.Parse(strings.NewReader(b.String())); e != nil {
+		t.Fatal(e)
+	}
+	estimate := b.Sizes()
+	if !reflect.DeepEqual(estimate, a.Sizes()) {
+		t.Errorf("estimated %v, assembled %v", estimate, a.Sizes())
+	}
+	if assembler.Total(estimate) != len(a.Code) {
+		t.Errorf("estimated %d words of %d", assembler.Total(estimate), len(a.Code))
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	b := VMTranslator{Compact: true}
+	Bootstrap(&b)
+	src := `function Sys.init 0
+call Util.b 0
+label END
+goto END
+function Util.a 0
+push constant 2
+return
+function Util.b 0
+push constant 1
+return`
+	Translate(&b, "Sys", strings.NewReader(src))
+	b.Eliminate()
+	var a assembler.Assembler
+	if e := a.Parse(strings.NewReader(b.String())); e != nil {
+		t.Fatal(e)
+	}
+	var lines []int
+	addrs := map[int]int{}
+	for _, addr := range b.Addresses() {
+		lines = append(lines, addr.Line)
+		if addr.File != "" {
+			addrs[addr.Line] = addr.Addr
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{0, 1, 2, 3, 4, 8, 9, 10}) {
+		t.Fatalf("lines %v", lines)
+	}
+	for line, label := range map[int]string{1: "Sys.init", 3: "Sys.init$END", 8: "Util.b"} {
+		if addrs[line] != a.Labels[label] {
+			t.Errorf("line %d at %d, %s at %d", line, addrs[line], label, a.Labels[label])
+		}
+	}
+	// label shares the address of goto, return is a jump to the routine
+	if addrs[3] != addrs[4] || addrs[2] >= addrs[3] || addrs[10]+2 != len(a.Code) {
+		t.Errorf("addresses %v of %d words", addrs, len(a.Code))
+	}
+}
@@ -0,0 +1,159 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Position is a line of VM file
+type Position struct {
+	File string
+	Line int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// UndefinedError is a call of a function not defined in translated code,
+// an OS added later may still define it
+type UndefinedError struct {
+	Pos      Position // zero for bootstrap
+	Function string
+}
+
+func (e *UndefinedError) Error() string {
+	if e.Pos.File == "" {
+		return "bootstrap calls undefined function " + e.Function
+	}
+	return fmt.Sprintf("%s: call to undefined function %s", e.Pos, e.Function)
+}
+
+// call is VM call command
+type call struct {
+	target string
+	args   int
+	pos    Position
+	from   string // calling function
+}
+
+// argUse is the highest argument a function reads or writes
+type argUse struct {
+	index int
+	pos   Position
+}
+
+// record collects functions, calls and arguments of translated command for Check
+func (b *VMTranslator) record(c Command, line int) {
+	if b.defs == nil {
+		b.defs = map[string]Position{}
+		b.args = map[string]argUse{}
+	}
+	pos := Position{b.name + ".vm", line}
+	switch c.Type {
+	case CmdFunction:
+		if first, ok := b.defs[c.Arg1]; ok {
+			b.linkErrors = append(b.linkErrors, fmt.Errorf("%s: function %s already defined at %s", pos, c.Arg1, first))
+			return
+		}
+		b.defs[c.Arg1] = pos
+	case CmdCall:
+		b.calls = append(b.calls, call{c.Arg1, c.Arg2, pos, b.fn})
+	case CmdPush, CmdPop:
+		if use, ok := b.args[b.fn]; c.Arg1 == "argument" && (!ok || c.Arg2 > use.index) {
+			b.args[b.fn] = argUse{c.Arg2, pos}
+		}
+	}
+}
+
+// Undefined returns called functions not defined in translated code, sorted
+func (b *VMTranslator) Undefined() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, c := range b.calls {
+		if _, ok := b.defs[c.target]; !ok && !seen[c.target] {
+			seen[c.target] = true
+			names = append(names, c.target)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check links translated code: calls of undefined functions, functions defined twice,
+// calls with different numbers of arguments or fewer arguments than the function uses,
+// missing Sys.init with bootstrap; errors are sorted by position, undefined functions
+// are *UndefinedError
+func (b *VMTranslator) Check() []error {
+	errs := append([]error(nil), b.linkErrors...)
+	if _, ok := b.defs["Sys.init"]; b.bootstrap && !ok {
+		errs = append(errs, &UndefinedError{Function: "Sys.init"})
+	}
+	reported := map[string]bool{}
+	first := map[string]call{}
+	for _, c := range b.calls {
+		if _, ok := b.defs[c.target]; !ok {
+			errs = append(errs, &UndefinedError{c.pos, c.target})
+			continue
+		}
+		if f, ok := first[c.target]; !ok {
+			first[c.target] = c
+		} else if f.args != c.args && !reported[c.target] {
+			reported[c.target] = true
+			errs = append(errs, fmt.Errorf("%s: %s called with %d arguments, with %d at %s", c.pos, c.target, c.args, f.args, f.pos))
+		}
+		if use, ok := b.args[c.target]; ok && use.index >= c.args {
+			errs = append(errs, fmt.Errorf("%s: %s called with %d arguments, uses argument %d at %s", c.pos, c.target, c.args, use.index, use.pos))
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// TranslateOS translates files of OS directories defining classes of undefined functions,
+// until all calls are resolved or no file is found; classes defined in translated code
+// are not replaced. Returns N of lines processed and ok
+func TranslateOS(b *VMTranslator, dirs []string) (int, bool) {
+	var lines int
+	ok := true
+	done := map[string]bool{}
+	for {
+		var filename string
+		for _, fn := range b.Undefined() {
+			if filename = b.classFile(fn, dirs); filename != "" && !done[filename] {
+				break
+			}
+			filename = ""
+		}
+		if filename == "" {
+			return lines, ok
+		}
+		done[filename] = true
+		n, fileOK := TranslateFile(b, filename)
+		lines += n
+		ok = ok && fileOK
+	}
+}
+
+// classFile finds Class.vm of function in dirs, empty if not found or class is already translated
+func (b *VMTranslator) classFile(fn string, dirs []string) string {
+	class := fn
+	if i := strings.Index(fn, "."); i >= 0 {
+		class = fn[:i]
+	}
+	for name := range b.defs {
+		if strings.HasPrefix(name, class+".") {
+			return ""
+		}
+	}
+	for _, dir := range dirs {
+		filename := filepath.Join(dir, class+".vm")
+		if _, e := os.Stat(filename); e == nil {
+			return filename
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package vmtranslator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var b VMTranslator
+	Bootstrap(&b)
+	main := `function Main.main 0
+call Foo.bar 2
+push constant 1
+call Main.f 1
+push constant 1
+push constant 2
+call Main.f 2
+return
+function Main.f 0
+push argument 1
+return
+function Main.f 0
+return`
+	Translate(&b, "Main", strings.NewReader(main))
+	var errs []string
+	for _, e := range b.Check() {
+		errs = append(errs, e.Error())
+	}
+	want := []string{
+		"Main.vm:12: function Main.f already defined at Main.vm:9",
+		"Main.vm:2: call to undefined function Foo.bar",
+		"Main.vm:4: Main.f called with 1 arguments, uses argument 1 at Main.vm:10",
+		"Main.vm:7: Main.f called with 2 arguments, with 1 at Main.vm:4",
+		"bootstrap calls undefined function Sys.init",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got %q", errs)
+	}
+}
+
+func TestTranslateOS(t *testing.T) {
+	var b VMTranslator
+	Bootstrap(&b)
+	TranslateFile(&b, "../testdata/FunctionCalls/StaticsTest/Sys.vm")
+	if undefined := b.Undefined(); !reflect.DeepEqual(undefined, []string{"Class1.get", "Class1.set", "Class2.get", "Class2.set"}) {
+		t.Fatalf("undefined %v", undefined)
+	}
+	if _, ok := TranslateOS(&b, []string{"missing", "../testdata/FunctionCalls/StaticsTest"}); !ok {
+		t.Fatal("OS translation failed")
+	}
+	if errs := b.Check(); len(errs) != 0 {
+		t.Errorf("%v", errs)
+	}
+}
+
+func TestUndefinedError(t *testing.T) {
+	var b VMTranslator
+	Translate(&b, "Main", strings.NewReader("function Main.main 0\ncall Foo.bar 0\nreturn"))
+	errs := b.Check()
+	if len(errs) != 1 {
+		t.Fatalf("%v", errs)
+	}
+	if e, ok := errs[0].(*UndefinedError); !ok || e.Function != "Foo.bar" || e.Pos != (Position{"Main.vm", 2}) {
+		t.Errorf("got %#v", errs[0])
+	}
+}
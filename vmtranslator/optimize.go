@@ -0,0 +1,178 @@
+package vmtranslator
+
+import (
+	"strings"
+)
+
+// instruction sequences of pushD, popD and popM
+var (
+	pushDCode = []string{"@0", "A=M", "M=D", "@0", "M=M+1"}
+	popDCode  = []string{"@0", "M=M-1", "A=M", "D=M"}
+	popMCode  = []string{"@0", "M=M-1", "A=M"}
+)
+
+// Optimize removes redundant instructions of translated code: push followed by pop,
+// loads of the value A already has and writes of D overwritten before use. Labels are
+// jump targets and end every pattern, comments are kept. Addresses of VM commands are
+// dropped. Returns N of instructions removed
+func (b *VMTranslator) Optimize() int {
+	var out strings.Builder
+	var chunks []chunk
+	var removed int
+	for _, p := range b.parts() {
+		lines := strings.Split(strings.TrimSuffix(p.code, "\n"), "\n")
+		before := instructions(p.code)
+		for peephole(&lines) {
+		}
+		code := ""
+		if p.code != "" {
+			code = strings.Join(lines, "\n") + "\n"
+		}
+		removed += before - instructions(code)
+		chunks = append(chunks, chunk{p.name, p.file, out.Len()})
+		out.WriteString(code)
+	}
+	b.chunks, b.mapped = chunks, nil
+	b.Reset()
+	b.WriteString(out.String())
+	return removed
+}
+
+// peephole applies every rule once, false if nothing changed
+func peephole(lines *[]string) bool {
+	changed := false
+	for _, rule := range []func([]string) map[int]bool{pushPop, repeatedA, deadD} {
+		if drop := rule(*lines); len(drop) > 0 {
+			var kept []string
+			for i, s := range *lines {
+				if !drop[i] {
+					kept = append(kept, s)
+				}
+			}
+			*lines = kept
+			changed = true
+		}
+	}
+	return changed
+}
+
+// instrs returns indexes of instructions and their blocks, a label starts a new block
+func instrs(lines []string) (idx, blocks []int) {
+	block := 0
+	for i, s := range lines {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "" || strings.HasPrefix(s, "//"):
+		case strings.HasPrefix(s, "("):
+			block++
+		default:
+			idx = append(idx, i)
+			blocks = append(blocks, block)
+		}
+	}
+	return idx, blocks
+}
+
+// matches tells if instructions from k are want, all in one block
+func matches(lines []string, idx, blocks []int, k int, want []string) bool {
+	if k+len(want) > len(idx) || blocks[k+len(want)-1] != blocks[k] {
+		return false
+	}
+	for i, s := range want {
+		if strings.TrimSpace(lines[idx[k+i]]) != s {
+			return false
+		}
+	}
+	return true
+}
+
+// pushPop removes pushD followed by popD, D keeps the value, when the next instruction loads A;
+// pushD followed by popM becomes a write to the top of the stack, @0 A=M M=D
+func pushPop(lines []string) map[int]bool {
+	drop := map[int]bool{}
+	idx, blocks := instrs(lines)
+	for k := 0; k < len(idx); k++ {
+		if !matches(lines, idx, blocks, k, pushDCode) {
+			continue
+		}
+		pop, end := k+len(pushDCode), k+len(pushDCode)+len(popDCode)
+		switch {
+		case !matches(lines, idx, blocks, pop, popMCode) || blocks[pop] != blocks[k]:
+		case matches(lines, idx, blocks, pop, popDCode) && end < len(idx) && blocks[end] == blocks[k] &&
+			strings.HasPrefix(strings.TrimSpace(lines[idx[end]]), "@"):
+			for n := k; n < end; n++ {
+				drop[idx[n]] = true
+			}
+			k = end - 1
+		default:
+			for n := k + 3; n < pop+len(popMCode); n++ {
+				drop[idx[n]] = true
+			}
+			k = pop + len(popMCode) - 1
+		}
+	}
+	return drop
+}
+
+// repeatedA removes @X when A already holds X: no label and no instruction writing A since @X
+func repeatedA(lines []string) map[int]bool {
+	drop := map[int]bool{}
+	loaded := ""
+	for i, s := range lines {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "" || strings.HasPrefix(s, "//"):
+		case strings.HasPrefix(s, "("):
+			loaded = ""
+		case strings.HasPrefix(s, "@"):
+			if s == loaded {
+				drop[i] = true
+			}
+			loaded = s
+		default:
+			if dest, _, _ := split(s); strings.Contains(dest, "A") {
+				loaded = ""
+			}
+		}
+	}
+	return drop
+}
+
+// deadD removes D=x when D is written again before it is read, a jump or a label
+func deadD(lines []string) map[int]bool {
+	drop := map[int]bool{}
+	idx, blocks := instrs(lines)
+	for k, i := range idx {
+		if dest, _, jump := split(strings.TrimSpace(lines[i])); dest != "D" || jump != "" {
+			continue
+		}
+	next:
+		for n := k + 1; n < len(idx) && blocks[n] == blocks[k]; n++ {
+			dest, comp, jump := split(strings.TrimSpace(lines[idx[n]]))
+			switch {
+			case strings.HasPrefix(strings.TrimSpace(lines[idx[n]]), "@"):
+			case strings.Contains(comp, "D") || jump != "":
+				break next
+			case strings.Contains(dest, "D"):
+				drop[i] = true
+				break next
+			}
+		}
+	}
+	return drop
+}
+
+// split splits C instruction into dest, comp and jump
+func split(s string) (dest, comp, jump string) {
+	if strings.HasPrefix(s, "@") || strings.HasPrefix(s, "(") || strings.HasPrefix(s, "//") {
+		return "", "", ""
+	}
+	comp = s
+	if i := strings.Index(comp, "="); i >= 0 {
+		dest, comp = comp[:i], comp[i+1:]
+	}
+	if i := strings.Index(comp, ";"); i >= 0 {
+		comp, jump = comp[:i], comp[i+1:]
+	}
+	return dest, comp, jump
+}
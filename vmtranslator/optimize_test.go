@@ -0,0 +1,100 @@
+package vmtranslator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPeephole(t *testing.T) {
+	in := `// push constant 7
+@7
+D=A
+@0
+A=M
+M=D
+@0
+M=M+1
+// pop static 0
+@0
+M=M-1
+A=M
+D=M
+@Foo.0
+M=D
+// push static 0
+@Foo.0
+D=M
+@0
+A=M
+M=D
+@0
+M=M+1
+// not
+@0
+M=M-1
+A=M
+D=!M
+@0
+A=M
+M=D
+@0
+M=M+1
+(LOOP)
+@0
+@0
+D=1
+D=0
+@LOOP
+D;JNE
+`
+	want := `// push constant 7
+@7
+D=A
+// pop static 0
+@Foo.0
+M=D
+// push static 0
+D=M
+@0
+A=M
+M=D
+// not
+D=!M
+@0
+A=M
+M=D
+@0
+M=M+1
+(LOOP)
+@0
+D=0
+@LOOP
+D;JNE
+`
+	var b VMTranslator
+	b.WriteString(in)
+	if n := b.Optimize(); n != 17 {
+		t.Errorf("removed %d instructions", n)
+	}
+	if b.String() != want {
+		t.Fatalf("got\n%s", b.String())
+	}
+}
+
+func TestOptimizeChunks(t *testing.T) {
+	var b VMTranslator
+	Bootstrap(&b)
+	Translate(&b, "Main", strings.NewReader(`function Main.f 0
+push constant 1
+not
+return
+function Main.g 0
+push constant 2
+return`))
+	b.Optimize()
+	for _, c := range b.chunks {
+		if c.name != "" && !strings.HasPrefix(b.String()[c.start:], "// function "+c.name) {
+			t.Errorf("chunk %s starts with %q", c.name, b.String()[c.start:c.start+20])
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind classifies VM code errors
+type ErrorKind int
+
+// kinds of VM code errors
+const (
+	UnknownCommand ErrorKind = iota
+	MissingArgument
+	ExtraArgument
+	BadSegment
+	BadIndex
+	BadName // label or function name
+	BadCount
+)
+
+// Error is an invalid VM command, column is 1-based and points to the wrong token
+type Error struct {
+	Kind   ErrorKind
+	File   string // empty if not known
+	Line   int    // 0 if not known
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.File != "":
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// at sets position of error of line s in file, column of the wrong token of
+// generate errors: segment, index or else the command
+func (e *Error) at(file string, line int, s string) *Error {
+	e.File, e.Line, e.Column = file, line, 1
+	i := map[ErrorKind]int{BadSegment: 1, BadIndex: 2}[e.Kind]
+	if tokens := tokenize(s); i < len(tokens) {
+		e.Column = tokens[i].col
+	}
+	return e
+}
+
+// token is a word of VM line
+type token struct {
+	s   string
+	col int // 1-based
+}
+
+// tokenize splits line on spaces and tabs up to comment
+func tokenize(s string) []token {
+	if i := strings.Index(s, "//"); i >= 0 {
+		s = s[:i]
+	}
+	var tokens []token
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '\t' || s[i] == '\r' {
+			if start >= 0 {
+				tokens = append(tokens, token{s[start:i], start + 1})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return tokens
+}
+
+// number of arguments of each command
+var arity = map[string]int{
+	"function": 2, "call": 2, "push": 2, "pop": 2,
+	"goto": 1, "if-goto": 1, "label": 1,
+	"return": 0, "add": 0, "sub": 0, "neg": 0, "eq": 0, "gt": 0, "lt": 0, "and": 0, "or": 0, "not": 0,
+}
+
+// largest index of segments, other segments take any 15 bit index
+var maxIndex = map[string]int{
+	"constant": 1<<15 - 1,
+	"temp":     7,
+	"pointer":  1,
+	"static":   239, // RAM 16-255
+}
+
+var segmentNames = map[string]bool{
+	"constant": true, "local": true, "argument": true, "this": true, "that": true,
+	"temp": true, "pointer": true, "static": true,
+}
+
+// ParseLine parses line of VM code with optional comment, ok is false for blank
+// and comment lines; errors are *Error without file and line
+func ParseLine(s string) (c Command, ok bool, err error) {
+	tokens := tokenize(s)
+	if len(tokens) == 0 {
+		return Command{}, false, nil
+	}
+	c, err = parse(tokens, len(s)+1)
+	return c, err == nil, err
+}
+
+// Parse parses and validates one VM command
+func Parse(s string) (Command, error) {
+	tokens := tokenize(s)
+	if len(tokens) == 0 {
+		return Command{}, &Error{Kind: UnknownCommand, Column: 1, Msg: "no command"}
+	}
+	return parse(tokens, len(s)+1)
+}
+
+// Validate checks that s is a single VM command the translator accepts
+func Validate(s string) error {
+	_, e := Parse(s)
+	return e
+}
+
+// parse builds command of tokens, end is column after the line
+func parse(tokens []token, end int) (Command, error) {
+	name := tokens[0]
+	n, ok := arity[name.s]
+	if !ok {
+		return Command{}, &Error{Kind: UnknownCommand, Column: name.col, Msg: fmt.Sprintf("unknown command '%s'", name.s)}
+	}
+	if len(tokens) < n+1 {
+		return Command{}, &Error{Kind: MissingArgument, Column: end, Msg: fmt.Sprintf("%s expects %d arguments", name.s, n)}
+	}
+	if len(tokens) > n+1 {
+		t := tokens[n+1]
+		return Command{}, &Error{Kind: ExtraArgument, Column: t.col, Msg: fmt.Sprintf("%s expects %d arguments, extra '%s'", name.s, n, t.s)}
+	}
+
+	switch name.s {
+	case "push", "pop":
+		seg := tokens[1]
+		if !segmentNames[seg.s] || name.s == "pop" && seg.s == "constant" {
+			return Command{}, &Error{Kind: BadSegment, Column: seg.col, Msg: fmt.Sprintf("%s to segment '%s'", name.s, seg.s)}
+		}
+		max, ok := maxIndex[seg.s]
+		if !ok {
+			max = 1<<15 - 1
+		}
+		i, e := number(tokens[2], max, BadIndex, seg.s+" index")
+		if e != nil {
+			return Command{}, e
+		}
+		typ := CmdPush
+		if name.s == "pop" {
+			typ = CmdPop
+		}
+		return Command{Type: typ, Arg1: seg.s, Arg2: i}, nil
+	case "function", "call":
+		if e := symbol(tokens[1]); e != nil {
+			return Command{}, e
+		}
+		what, typ := "locals", CmdFunction
+		if name.s == "call" {
+			what, typ = "arguments", CmdCall
+		}
+		i, e := number(tokens[2], 1<<15-1, BadCount, "number of "+what)
+		if e != nil {
+			return Command{}, e
+		}
+		return Command{Type: typ, Arg1: tokens[1].s, Arg2: i}, nil
+	case "label", "goto", "if-goto":
+		if e := symbol(tokens[1]); e != nil {
+			return Command{}, e
+		}
+		typ := map[string]CmdType{"label": CmdLabel, "goto": CmdGoto, "if-goto": CmdIf}[name.s]
+		return Command{Type: typ, Arg1: tokens[1].s}, nil
+	case "return":
+		return Command{Type: CmdReturn}, nil
+	}
+	return Command{Type: CmdArithmetic, Arg1: name.s}, nil
+}
+
+// number parses decimal from 0 to max
+func number(t token, max int, kind ErrorKind, what string) (int, error) {
+	for _, r := range t.s {
+		if r < '0' || r > '9' {
+			return 0, &Error{Kind: kind, Column: t.col, Msg: fmt.Sprintf("%s '%s' is not a number", what, t.s)}
+		}
+	}
+	i, e := strconv.Atoi(t.s)
+	if e != nil || i > max {
+		return 0, &Error{Kind: kind, Column: t.col, Msg: fmt.Sprintf("%s %s out of range 0-%d", what, t.s, max)}
+	}
+	return i, nil
+}
+
+// symbol checks label or function name: letters, digits, '_', '.', '$' and ':',
+// not starting with a digit
+func symbol(t token) error {
+	for i, r := range t.s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', r == '_', r == '.', r == '$', r == ':':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return &Error{Kind: BadName, Column: t.col + i, Msg: fmt.Sprintf("bad name '%s'", t.s)}
+		}
+	}
+	return nil
+}
@@ -3,8 +3,8 @@ package vmtranslator
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -14,18 +14,20 @@ import (
 
 const comments = true
 
-type cmdType int
+// CmdType is kind of VM command
+type CmdType int
 
+// kinds of VM commands
 const (
-	cmdArithmetic cmdType = iota
-	cmdPush
-	cmdPop
-	cmdLabel
-	cmdGoto
-	cmdIf
-	cmdFunction
-	cmdReturn
-	cmdCall
+	CmdArithmetic CmdType = iota
+	CmdPush
+	CmdPop
+	CmdLabel
+	CmdGoto
+	CmdIf
+	CmdFunction
+	CmdReturn
+	CmdCall
 )
 
 const (
@@ -47,22 +49,47 @@ var ptr = map[string]int{
 	temp:     5,
 }
 
-type cmdStruct struct {
-	cmd  cmdType
-	arg1 string
-	arg2 int
+// Command is parsed VM command
+type Command struct {
+	Type CmdType
+	Arg1 string // segment, label or function name
+	Arg2 int    // index or number of locals or arguments
 }
 
 // VMTranslator translates VM to ASM
 type VMTranslator struct {
 	jumpIndex int // jump label index
 	strings.Builder
-	name string
+	name   string
+	fn     string          // function being translated, labels are local to it
+	labels map[string]bool // labels defined in fn
+	jumps  []jump          // jumps of fn, checked at its end
+
+	// for Check
+	bootstrap  bool
+	defs       map[string]Position // functions defined
+	calls      []call
+	args       map[string]argUse // by function
+	linkErrors []error
+
+	chunks []chunk   // functions in output, for Eliminate
+	mapped []mapping // VM commands in output, for Addresses
+
+	// Compact calls shared call, return and comparison routines instead of inlining them
+	Compact  bool
+	routines bool // routines emitted
+}
+
+// jump is goto or if-goto to label at line
+type jump struct {
+	label string
+	line  int
 }
 
 // Bootstrap adds init section
 func Bootstrap(b *VMTranslator) {
 	log.Println("Compiling bootstrap code")
+	b.bootstrap = true
 	// set sp
 	if comments {
 		b.c("// bootstrap section")
@@ -90,6 +117,7 @@ func Bootstrap(b *VMTranslator) {
 	b.pushD()
 	b.a("Sys.init")
 	b.c("0;JMP")
+	Routines(b)
 }
 
 // TranslateFile translates one file, returns N of lines processed and ok
@@ -98,19 +126,28 @@ func TranslateFile(b *VMTranslator, filename string) (int, bool) {
 	if err != nil {
 		return 0, false
 	}
-	scanner := bufio.NewScanner(file)
-	b.name = strings.TrimSuffix(path.Base(filename), ".vm")
-	return translate(b, scanner)
+	defer file.Close()
+	return Translate(b, strings.TrimSuffix(path.Base(filename), ".vm"), file)
+}
+
+// Translate translates VM code of file name (without extension) read from r
+func Translate(b *VMTranslator, name string, r io.Reader) (int, bool) {
+	b.name = name
+	return translate(b, bufio.NewScanner(r))
 }
 
 func translate(b *VMTranslator, scanner *bufio.Scanner) (int, bool) {
 	var errFound bool
 	var line int
+	b.fn = ""
+	b.labels = map[string]bool{}
+	b.jumps = nil
+	b.chunks = append(b.chunks, chunk{"", b.name + ".vm", b.Len()})
 
 	for scanner.Scan() {
 		line++
-		s := scanner.Text()
-		s = strings.TrimSpace(s)
+		raw := scanner.Text()
+		s := strings.TrimSpace(raw)
 		if s == "" {
 			continue
 		}
@@ -120,55 +157,71 @@ func translate(b *VMTranslator, scanner *bufio.Scanner) (int, bool) {
 			}
 			continue
 		}
+		start := b.Len()
 		if comments {
 			b.c("// " + s)
 		}
-		c, e := parse(s)
+		c, e := Parse(raw)
 		if e != nil {
-			log.Printf("Line %d %s: '%s'\n", line, e, s)
+			e := e.(*Error)
+			e.File, e.Line = b.name+".vm", line
+			log.Printf("%s: '%s'\n", e, s)
 			errFound = true
 			continue
 		}
+		if c.Type == CmdFunction {
+			if !b.checkJumps() {
+				errFound = true
+			}
+			b.chunks = append(b.chunks, chunk{c.Arg1, b.name + ".vm", start})
+		}
 		if e := generate(b, c); e != nil {
-			log.Printf("Line %d %s: '%s'\n", line, e, s)
+			log.Printf("%s: '%s'\n", e.at(b.name+".vm", line, raw), s)
 			errFound = true
 			continue
 		}
+		b.record(c, line)
+		b.mapped = append(b.mapped, mapping{Position{b.name + ".vm", line}, start})
+		switch c.Type {
+		case CmdLabel:
+			b.labels[c.Arg1] = true
+		case CmdGoto, CmdIf:
+			b.jumps = append(b.jumps, jump{c.Arg1, line})
+		}
+	}
+	if !b.checkJumps() {
+		errFound = true
 	}
 	log.Printf("%d lines processed.\n", line)
 	return line, !errFound
 
 }
 
-func parse(s string) (cmdStruct, error) {
-	tokens := strings.Split(s, " ")
-
-	switch tokens[0] {
-	case "function":
-		arg2, _ := strconv.Atoi(tokens[2])
-		return cmdStruct{cmd: cmdFunction, arg1: tokens[1], arg2: arg2}, nil
-	case "call":
-		arg2, _ := strconv.Atoi(tokens[2])
-		return cmdStruct{cmd: cmdCall, arg1: tokens[1], arg2: arg2}, nil
-	case "goto":
-		return cmdStruct{cmd: cmdGoto, arg1: tokens[1]}, nil
-	case "if-goto":
-		return cmdStruct{cmd: cmdIf, arg1: tokens[1]}, nil
-	case "return":
-		return cmdStruct{cmd: cmdReturn}, nil
-	case "add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not":
-		return cmdStruct{cmd: cmdArithmetic, arg1: tokens[0]}, nil
-	case "push":
-		arg2, _ := strconv.Atoi(tokens[2])
-		return cmdStruct{cmd: cmdPush, arg1: tokens[1], arg2: arg2}, nil
-	case "pop":
-		arg2, _ := strconv.Atoi(tokens[2])
-		return cmdStruct{cmd: cmdPop, arg1: tokens[1], arg2: arg2}, nil
-	case "label":
-		return cmdStruct{cmd: cmdLabel, arg1: tokens[1]}, nil
+// checkJumps reports jumps to labels not defined in the function just translated
+// and starts the next function, false if any label is missing
+func (b *VMTranslator) checkJumps() bool {
+	ok := true
+	for _, j := range b.jumps {
+		if !b.labels[j.label] {
+			where := "file"
+			if b.fn != "" {
+				where = "function " + b.fn
+			}
+			log.Printf("%s.vm:%d: label %s not defined in %s\n", b.name, j.line, j.label, where)
+			ok = false
+		}
 	}
+	b.labels = map[string]bool{}
+	b.jumps = nil
+	return ok
+}
 
-	return cmdStruct{}, errors.New("parsing")
+// label returns assembly symbol of VM label, scoped by enclosing function as Function$label
+func (b *VMTranslator) label(name string) string {
+	if b.fn == "" {
+		return name
+	}
+	return b.fn + "$" + name
 }
 
 // A command
@@ -228,9 +281,76 @@ func (b *VMTranslator) popD() (int, error) {
 	return b.WriteString("@0\nM=M-1\nA=M\nD=M\n")
 }
 
-func generate(b *VMTranslator, c cmdStruct) error {
-	switch c.cmd {
-	case cmdCall:
+// ret returns from function to the caller
+func (b *VMTranslator) ret() {
+	// FRAME = LCL (R13)
+	b.a(local)
+	b.c("D=M")
+	b.a(13)
+	b.c("M=D")
+	// RET = *(FRAME-5) (R14), read before return value overwrites it when there are no arguments
+	b.a(5)
+	b.c("A=D-A")
+	b.c("D=M")
+	b.a(14)
+	b.c("M=D")
+	// ARG 0 = pop()
+	b.popD()
+	b.a(argument)
+	b.c("A=M")
+	b.c("M=D")
+	// sp = *ARG + 1
+	b.c("A=A+1")
+	b.c("D=A")
+	b.a(sp)
+	b.c("M=D")
+	// THAT = * (FRAME - 1)
+	b.a(13)
+	b.c("D=M")
+	b.a(1)
+	b.c("A=D-A")
+	b.c("D=M")
+	b.a(that)
+	b.c("M=D")
+	// THIS = *( FRAME - 2)
+	b.a(13)
+	b.c("D=M")
+	b.a(2)
+	b.c("A=D-A")
+	b.c("D=M")
+	b.a(this)
+	b.c("M=D")
+	// ARG = *(FRAME - 3)
+	b.a(13)
+	b.c("D=M")
+	b.a(3)
+	b.c("A=D-A")
+	b.c("D=M")
+	b.a(argument)
+	b.c("M=D")
+	// LCL = *(FRAME - 4)
+	b.a(13)
+	b.c("D=M")
+	b.a(4)
+	b.c("A=D-A")
+	b.c("D=M")
+	b.a(local)
+	b.c("M=D")
+	// goto RET
+	b.a(14)
+	b.c("A=M")
+	b.c("0;JMP")
+}
+
+// generate writes assembly of command, errors have no position
+func generate(b *VMTranslator, c Command) *Error {
+	if b.Compact {
+		if ok := compact(b, c); ok {
+			return nil
+		}
+	}
+	switch c.Type {
+	case CmdCall:
 		// push ret address (see below)
 		label, _ := b.l()
 		b.a(label)
@@ -248,8 +368,8 @@ func generate(b *VMTranslator, c cmdStruct) error {
 		b.a(this)
 		b.c("D=M")
 		b.pushD()
-		// push ARG
-		b.a(argument)
+		// push THAT
+		b.a(that)
 		b.c("D=M")
 		b.pushD()
 		// ARG = sp - (n of args) - 5
@@ -257,7 +377,7 @@ func generate(b *VMTranslator, c cmdStruct) error {
 		b.c("D=M")
 		b.a(5)
 		b.c("D=D-A")
-		b.a(c.arg2)
+		b.a(c.Arg2)
 		b.c("D=D-A")
 		b.a(argument)
 		b.c("M=D")
@@ -267,92 +387,38 @@ func generate(b *VMTranslator, c cmdStruct) error {
 		b.a(local)
 		b.c("M=D")
 		// goto f
-		b.a(c.arg1)
+		b.a(c.Arg1)
 		b.c("0;JMP")
 		// ret label
 		b.l(label)
 
-	case cmdReturn:
-		// FRAME = LCL (temp0)
-		b.a(local)
-		b.c("D=M")
-		b.a(temp)
-		b.c("M=D")
-		// RET = *(FRAME-5) (temp1)
-		b.a(5)
-		b.c("D=D-A")
-		b.a(temp)
-		b.c("A=A+1")
-		b.c("M=D")
-		// ARG 0 = pop()
+	case CmdReturn:
+		b.ret()
+	case CmdIf:
 		b.popD()
-		b.a(argument)
-		b.c("A=M")
-		b.c("M=D")
-		// sp = *ARG + 1
-		b.c("A=A+1")
-		b.c("D=A")
-		b.a(sp)
-		b.c("M=D")
-		// THAT = * (FRAME - 1)
-		b.a(temp)
-		b.c("D=M")
-		b.a(1)
-		b.c("A=D-A")
-		b.c("D=M")
-		b.a(that)
-		b.c("M=D")
-		// THIS = *( FRAME - 2)
-		b.a(temp)
-		b.c("D=M")
-		b.a(2)
-		b.c("A=D-A")
-		b.c("D=M")
-		b.a(this)
-		b.c("M=D")
-		// ARG = *(FRAME - 3)
-		b.a(temp)
-		b.c("D=M")
-		b.a(3)
-		b.c("A=D-A")
-		b.c("D=M")
-		b.a(argument)
-		b.c("M=D")
-		// LCL = *(FRAME - 4)
-		b.a(temp)
-		b.c("D=M")
-		b.a(4)
-		b.c("A=D-A")
-		b.c("D=M")
-		b.a(local)
-		b.c("M=D")
-		// goto RET
-		b.a(temp)
-		b.c("A=A+1")
-		b.c("A=M")
-		b.c("A=M")
-		b.c("0;JMP")
-	case cmdIf:
-		b.popD()
-		b.a(c.arg1)
+		b.a(b.label(c.Arg1))
 		b.c("D;JNE")
-	case cmdGoto:
-		b.a(c.arg1)
+	case CmdGoto:
+		b.a(b.label(c.Arg1))
 		b.c("0;JMP")
-	case cmdLabel:
-		b.c("(%s)", c.arg1)
-	case cmdFunction:
-		b.c("(%s)", c.arg1)
-		for ; c.arg2 > 0; c.arg2-- { // preallocate locals
-			b.pushD() // no need to clear, this should be job of c higher level language
+	case CmdLabel:
+		b.c("(%s)", b.label(c.Arg1))
+	case CmdFunction:
+		b.fn = c.Arg1
+		b.c("(%s)", c.Arg1)
+		if c.Arg2 > 0 { // locals start as 0
+			b.c("D=0")
+		}
+		for ; c.Arg2 > 0; c.Arg2-- {
+			b.pushD()
 		}
-	case cmdPop: // pop from stack
+	case CmdPop: // pop from stack
 		// to receiver memory region
-		switch c.arg1 {
+		switch c.Arg1 {
 		case "this", "that", "local", "argument":
-			b.a(c.arg1)
+			b.a(c.Arg1)
 			b.c("D=M") // diff
-			b.a(c.arg2)
+			b.a(c.Arg2)
 			b.c("D=D+A")
 			b.a(13)
 			b.c("M=D")
@@ -361,9 +427,9 @@ func generate(b *VMTranslator, c cmdStruct) error {
 			b.c("A=M")
 			b.c("M=D")
 		case "temp":
-			b.a(c.arg1)
+			b.a(c.Arg1)
 			b.c("D=A") // diff
-			b.a(c.arg2)
+			b.a(c.Arg2)
 			b.c("D=D+A")
 			b.a(13)
 			b.c("M=D")
@@ -373,62 +439,62 @@ func generate(b *VMTranslator, c cmdStruct) error {
 			b.c("M=D")
 		case "static":
 			b.popD()
-			b.c("@%s.%d", b.name, c.arg2)
+			b.c("@%s.%d", b.name, c.Arg2)
 			b.c("M=D")
 		case "pointer": // pointer 0 -> this, pointer 1 -> that
 			var addr int
-			switch c.arg2 {
+			switch c.Arg2 {
 			case 0:
 				addr = ptr["this"]
 			case 1:
 				addr = ptr["that"]
 			default:
-				return errors.New("wrong pointer")
+				return &Error{Kind: BadIndex, Msg: "wrong pointer"}
 			}
 			b.popD()
 			b.a(addr)
 			b.c("M=D")
 		default:
-			return errors.New("wrong memory region")
+			return &Error{Kind: BadSegment, Msg: "wrong memory region"}
 		}
-	case cmdPush:
-		switch c.arg1 {
+	case CmdPush:
+		switch c.Arg1 {
 		case "constant":
-			b.a(c.arg2)
+			b.a(c.Arg2)
 			b.c("D=A")
 		case "this", "that", "local", "argument":
-			b.a(c.arg1)
+			b.a(c.Arg1)
 			b.c("D=M") // diff
-			b.a(c.arg2)
+			b.a(c.Arg2)
 			b.c("A=A+D")
 			b.c("D=M")
 		case "temp":
-			b.a(c.arg1)
+			b.a(c.Arg1)
 			b.c("D=A") // diff
-			b.a(c.arg2)
+			b.a(c.Arg2)
 			b.c("A=A+D")
 			b.c("D=M")
 		case "pointer": // pointer 0 -> this, pointer 1 -> that
 			var addr int
-			switch c.arg2 {
+			switch c.Arg2 {
 			case 0:
 				addr = ptr["this"]
 			case 1:
 				addr = ptr["that"]
 			default:
-				return errors.New("wrong pointer")
+				return &Error{Kind: BadIndex, Msg: "wrong pointer"}
 			}
 			b.a(addr)
 			b.c("D=M")
 		case "static":
-			b.c("@%s.%d", b.name, c.arg2)
+			b.c("@%s.%d", b.name, c.Arg2)
 			b.c("D=M")
 		default:
-			return errors.New("wrong memory region")
+			return &Error{Kind: BadSegment, Msg: "wrong memory region"}
 		}
 		b.pushD()
-	case cmdArithmetic: // after pop M stands for X, D stands for Y so  'x-y'  == 'm-y' i.e. subtract from later element on stack
-		switch c.arg1 {
+	case CmdArithmetic: // after pop M stands for X, D stands for Y so  'x-y'  == 'm-y' i.e. subtract from later element on stack
+		switch c.Arg1 {
 		case "add":
 			b.popD()
 			b.popM()
@@ -457,7 +523,7 @@ func generate(b *VMTranslator, c cmdStruct) error {
 			b.c("D=M-D")
 			labelA, _ := b.l()
 			b.a(labelA)
-			switch c.arg1 {
+			switch c.Arg1 {
 			case "eq":
 				b.c("D;JEQ")
 			case "gt":
@@ -473,11 +539,11 @@ func generate(b *VMTranslator, c cmdStruct) error {
 			b.c("D=-1")
 			b.l(labelB)
 		default:
-			return errors.New("not implemented")
+			return &Error{Kind: UnknownCommand, Msg: "not implemented"}
 		}
 		b.pushD()
 	default:
-		return errors.New("not implemented")
+		return &Error{Kind: UnknownCommand, Msg: "not implemented"}
 	}
 	return nil
 }
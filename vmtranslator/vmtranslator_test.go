@@ -53,7 +53,7 @@ A=M
 M=D
 @0
 M=M+1
-@2
+@4
 D=M
 @0
 A=M
@@ -100,12 +100,12 @@ M=M+1
 // return
 @1
 D=M
-@5
+@13
 M=D
 @5
-D=D-A
-@5
-A=A+1
+A=D-A
+D=M
+@14
 M=D
 @0
 M=M-1
@@ -118,37 +118,35 @@ A=A+1
 D=A
 @0
 M=D
-@5
+@13
 D=M
 @1
 A=D-A
 D=M
 @4
 M=D
-@5
+@13
 D=M
 @2
 A=D-A
 D=M
 @3
 M=D
-@5
+@13
 D=M
 @3
 A=D-A
 D=M
 @2
 M=D
-@5
+@13
 D=M
 @4
 A=D-A
 D=M
 @1
 M=D
-@5
-A=A+1
-A=M
+@14
 A=M
 0;JMP
 `
@@ -162,3 +160,103 @@ A=M
 		t.Fatalf("want: %s, got: %s", out, b.String())
 	}
 }
+
+func TestValidate(t *testing.T) {
+	for _, s := range []string{"push constant 7", "pop pointer 1", "label LOOP", "call Math.multiply 2", "return", "not"} {
+		if e := Validate(s); e != nil {
+			t.Errorf("'%s': %s", s, e)
+		}
+	}
+	for _, s := range []string{"push constant", "pop pointer 2", "push heap 1", "goto", "add 1", "push local x", "jump X",
+		"push temp 8", "push constant 32768", "pop constant 0", "push local -1", "function Main.f x", "label 1A", "goto A-B"} {
+		if Validate(s) == nil {
+			t.Errorf("'%s' accepted", s)
+		}
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	var b VMTranslator
+	for _, test := range []struct {
+		c    Command
+		raw  string
+		want string
+	}{
+		{Command{Type: CmdPush, Arg1: "pointer", Arg2: 2}, "push pointer  2", "Foo.vm:3:15: wrong pointer"},
+		{Command{Type: CmdPop, Arg1: "heap"}, " pop heap 0", "Foo.vm:3:6: wrong memory region"},
+		{Command{Type: CmdArithmetic, Arg1: "mul"}, "\tmul", "Foo.vm:3:2: not implemented"},
+	} {
+		e := generate(&b, test.c)
+		if e == nil {
+			t.Fatalf("%+v accepted", test.c)
+		}
+		if s := e.at("Foo.vm", 3, test.raw).Error(); s != test.want {
+			t.Errorf("%s, want %s", s, test.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	var b VMTranslator
+	for _, name := range []string{"A", "B"} {
+		in := "function " + name + ".loop 0\nlabel LOOP\ngoto LOOP\n"
+		if _, ok := Translate(&b, name, strings.NewReader(in)); !ok {
+			t.Fatal(name)
+		}
+	}
+	for _, s := range []string{"(A.loop$LOOP)\n", "@A.loop$LOOP\n", "(B.loop$LOOP)\n", "@B.loop$LOOP\n"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("no %q in\n%s", s, b.String())
+		}
+	}
+
+	// label of another function is not visible
+	in := "function C.f 0\nlabel END\nfunction C.g 0\nif-goto END\nreturn\n"
+	if _, ok := Translate(&b, "C", strings.NewReader(in)); ok {
+		t.Error("jump to label of another function accepted")
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		c    Command
+		ok   bool
+	}{
+		{"\tpush\tlocal  0 // x", Command{Type: CmdPush, Arg1: "local", Arg2: 0}, true},
+		{"call Math.multiply 2\r", Command{Type: CmdCall, Arg1: "Math.multiply", Arg2: 2}, true},
+		{"label WHILE_EXP0//loop", Command{Type: CmdLabel, Arg1: "WHILE_EXP0"}, true},
+		{"   // comment", Command{}, false},
+		{"", Command{}, false},
+	} {
+		c, ok, e := ParseLine(test.line)
+		if e != nil || ok != test.ok || c != test.c {
+			t.Errorf("%q: %+v %v %v", test.line, c, ok, e)
+		}
+	}
+
+	for _, test := range []struct {
+		line   string
+		kind   ErrorKind
+		column int
+	}{
+		{"push constant", MissingArgument, 14},
+		{"\tpush local 0 1", ExtraArgument, 15},
+		{"push heap 1", BadSegment, 6},
+		{"pop temp 8 // x", BadIndex, 10},
+		{"push pointer x", BadIndex, 14},
+		{"function Main.f -1", BadCount, 17},
+		{"goto LOOP-1", BadName, 10},
+		{"  jump X", UnknownCommand, 3},
+	} {
+		_, _, e := ParseLine(test.line)
+		if err, ok := e.(*Error); !ok || err.Kind != test.kind || err.Column != test.column {
+			t.Errorf("%q: %v", test.line, e)
+		}
+	}
+
+	_, ok := Translate(&VMTranslator{}, "Main", strings.NewReader("function Main.f 0\npush temp 9\nreturn\n"))
+	if ok {
+		t.Error("temp 9 accepted")
+	}
+}